@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// A strategy computes the delays between attempts after failures.
+type strategy interface {
+	// Delay returns the delay before retry n (from 0) of a run of failures,
+	// given the previous delay (0 for the first retry).
+	Delay(n int, prev time.Duration) time.Duration
+}
+
+// exponential multiplies the delay by factor after each failure.
+type exponential struct {
+	min    time.Duration
+	factor float64
+}
+
+func (e exponential) Delay(n int, _ time.Duration) time.Duration {
+	return scale(e.min, math.Pow(e.factor, float64(n)))
+}
+
+// linear increases the delay by (factor-1)*min after each failure, so that
+// the second delay is factor*min as for exponential.
+type linear struct {
+	min    time.Duration
+	factor float64
+}
+
+func (l linear) Delay(n int, _ time.Duration) time.Duration {
+	return scale(l.min, 1+float64(n)*(l.factor-1))
+}
+
+// constant always waits for the same delay.
+type constant struct{ min time.Duration }
+
+func (c constant) Delay(int, time.Duration) time.Duration { return c.min }
+
+// fibonacci scales the delay by the Fibonacci numbers 1, 1, 2, 3, 5, ...
+type fibonacci struct{ min time.Duration }
+
+func (f fibonacci) Delay(n int, _ time.Duration) time.Duration {
+	a, b := 1.0, 1.0
+	for range n {
+		a, b = b, a+b
+	}
+	return scale(f.min, a)
+}
+
+// decorrelated chooses each delay at random between min and factor times the
+// previous delay, as described in "Exponential Backoff And Jitter" (AWS
+// Architecture Blog, 2015).
+type decorrelated struct {
+	min    time.Duration
+	factor float64
+	rng    *rand.Rand
+}
+
+func (d decorrelated) Delay(_ int, prev time.Duration) time.Duration {
+	hi := scale(max(prev, d.min), d.factor)
+	return d.min + time.Duration(d.rng.Int64N(int64(hi-d.min)+1))
+}
+
+// scale returns d*f, limited to the range of time.Duration.
+func scale(d time.Duration, f float64) time.Duration {
+	if v := float64(d) * f; v < math.MaxInt64 {
+		return time.Duration(v)
+	}
+	return math.MaxInt64
+}
+
+// A jitter randomizes a delay.
+type jitter func(rng *rand.Rand, d time.Duration) time.Duration
+
+var jitters = map[string]jitter{
+	"none": func(_ *rand.Rand, d time.Duration) time.Duration { return d },
+
+	// Full jitter waits for a random time up to the delay.
+	"full": func(rng *rand.Rand, d time.Duration) time.Duration {
+		return time.Duration(rng.Int64N(int64(d) + 1))
+	},
+
+	// Equal jitter waits for half the delay, plus a random time up to half
+	// the delay.
+	"equal": func(rng *rand.Rand, d time.Duration) time.Duration {
+		return d/2 + time.Duration(rng.Int64N(int64(d/2)+1))
+	},
+}
+
+// A backoff tracks the delays between attempts for a strategy.
+type backoff struct {
+	strategy strategy
+	jitter   jitter
+	max      time.Duration
+	rng      *rand.Rand
+
+	n    int           // number of failures since the last reset
+	prev time.Duration // the previous delay, before jitter
+}
+
+// newBackoff returns a backoff using the named strategy and jitter, with
+// delays from min to max. The random source rng is used for jitter and by
+// the decorrelated strategy.
+func newBackoff(name string, min, max time.Duration, factor float64, jitterBy string, rng *rand.Rand) (*backoff, error) {
+	var s strategy
+	switch name {
+	case "exponential":
+		s = exponential{min, factor}
+	case "linear":
+		s = linear{min, factor}
+	case "constant":
+		s = constant{min}
+	case "fibonacci":
+		s = fibonacci{min}
+	case "decorrelated":
+		if jitterBy != "none" {
+			return nil, fmt.Errorf("decorrelated backoff is already randomized; jitter %q is not allowed", jitterBy)
+		}
+		s = decorrelated{min, factor, rng}
+	default:
+		return nil, fmt.Errorf("unknown backoff strategy %q", name)
+	}
+	j, ok := jitters[jitterBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown jitter %q", jitterBy)
+	}
+	return &backoff{strategy: s, jitter: j, max: max, rng: rng}, nil
+}
+
+// Next returns the delay before the next attempt, after a failure.
+func (b *backoff) Next() time.Duration {
+	d := min(b.strategy.Delay(b.n, b.prev), b.max)
+	b.n++
+	b.prev = d
+	return b.jitter(b.rng, d)
+}
+
+// Reset restarts the sequence of delays, after a success.
+func (b *backoff) Reset() { b.n, b.prev = 0, 0 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStrategies(t *testing.T) {
+	const s = time.Second
+	tests := []struct {
+		name   string
+		factor float64
+		want   []time.Duration
+	}{
+		{"exponential", 2, []time.Duration{1 * s, 2 * s, 4 * s, 8 * s, 16 * s, 20 * s, 20 * s}},
+		{"exponential", 1.5, []time.Duration{1 * s, 1500 * time.Millisecond, 2250 * time.Millisecond}},
+		{"linear", 2, []time.Duration{1 * s, 2 * s, 3 * s, 4 * s, 5 * s}},
+		{"linear", 4, []time.Duration{1 * s, 4 * s, 7 * s, 10 * s, 13 * s, 16 * s, 19 * s, 20 * s}},
+		{"constant", 2, []time.Duration{1 * s, 1 * s, 1 * s}},
+		{"fibonacci", 2, []time.Duration{1 * s, 1 * s, 2 * s, 3 * s, 5 * s, 8 * s, 13 * s, 20 * s}},
+	}
+	for _, tc := range tests {
+		b, err := newBackoff(tc.name, s, 20*s, tc.factor, "none", nil)
+		if err != nil {
+			t.Fatalf("newBackoff(%q): unexpected error: %v", tc.name, err)
+		}
+		// Check the sequence twice, to verify that Reset restarts it.
+		for range 2 {
+			var got []time.Duration
+			for range tc.want {
+				got = append(got, b.Next())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Backoff %q factor %v (-want, +got):\n%s", tc.name, tc.factor, diff)
+			}
+			b.Reset()
+		}
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	b, err := newBackoff("exponential", time.Second, time.Hour, 10, "none", nil)
+	if err != nil {
+		t.Fatalf("newBackoff: unexpected error: %v", err)
+	}
+	for i := range 100 {
+		if d := b.Next(); d < time.Second || d > time.Hour {
+			t.Fatalf("Delay %d: got %v, want between 1s and 1h", i, d)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	const lo, hi = 100 * time.Millisecond, 10 * time.Second
+	tests := []struct {
+		backoff, jitter string
+		check           func(d, prev time.Duration) bool // d is in range
+	}{
+		{"constant", "full", func(d, _ time.Duration) bool { return d >= 0 && d <= lo }},
+		{"constant", "equal", func(d, _ time.Duration) bool { return d >= lo/2 && d <= lo }},
+		{"decorrelated", "none", func(d, prev time.Duration) bool {
+			return d >= lo && d <= min(hi, 3*max(prev, lo))
+		}},
+	}
+	for _, tc := range tests {
+		// Two backoffs with the same seed give the same delays.
+		seq := func() []time.Duration {
+			b, err := newBackoff(tc.backoff, lo, hi, 3, tc.jitter, rand.New(rand.NewPCG(1, 2)))
+			if err != nil {
+				t.Fatalf("newBackoff(%q, %q): unexpected error: %v", tc.backoff, tc.jitter, err)
+			}
+			var ds []time.Duration
+			for range 200 {
+				ds = append(ds, b.Next())
+			}
+			return ds
+		}
+		got := seq()
+		if diff := cmp.Diff(got, seq()); diff != "" {
+			t.Errorf("Backoff %q jitter %q is not deterministic (-first, +second):\n%s", tc.backoff, tc.jitter, diff)
+		}
+
+		var prev time.Duration
+		distinct := make(map[time.Duration]bool)
+		for i, d := range got {
+			if !tc.check(d, prev) {
+				t.Errorf("Backoff %q jitter %q delay %d: %v out of range (prev %v)", tc.backoff, tc.jitter, i, d, prev)
+			}
+			distinct[d] = true
+			prev = d
+		}
+		if len(distinct) < len(got)/2 {
+			t.Errorf("Backoff %q jitter %q: only %d distinct delays of %d", tc.backoff, tc.jitter, len(distinct), len(got))
+		}
+	}
+}
+
+func TestBackoffErrors(t *testing.T) {
+	tests := []struct {
+		backoff, jitter, want string
+	}{
+		{"quadratic", "none", "unknown backoff strategy"},
+		{"linear", "partial", "unknown jitter"},
+		{"decorrelated", "full", "already randomized"},
+	}
+	for _, tc := range tests {
+		_, err := newBackoff(tc.backoff, time.Second, time.Minute, 2, tc.jitter, nil)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("newBackoff(%q, %q): got %v, want %q", tc.backoff, tc.jitter, err, tc.want)
+		}
+	}
+}
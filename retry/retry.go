@@ -1,5 +1,5 @@
-// Program retry repeatedly invokes a subcommand, with exponential backoff,
-// until it succeeds.
+// Program retry repeatedly invokes a subcommand, with backoff, until it
+// succeeds.
 package main
 
 import (
@@ -7,6 +7,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -18,7 +19,13 @@ var (
 	doRepeat  = flag.Bool("repeat", false, "After successful execution, run the command again")
 	minPoll   = flag.Duration("min", 500*time.Millisecond, "Minimum poll interval")
 	maxPoll   = flag.Duration("max", 1*time.Minute, "Maximum poll interval")
+	backoffBy = flag.String("backoff", "exponential", "Backoff strategy (exponential, linear, constant, fibonacci, decorrelated)")
+	factor    = flag.Float64("factor", 2, "Growth factor for exponential, linear, and decorrelated backoff")
+	jitterBy  = flag.String("jitter", "none", "Randomize poll intervals (none, full, equal)")
 	pauseTime = flag.Duration("pause", 0, "Time to pause after a successful invocation")
+	attempts  = flag.Int("attempts", 0, "Give up after this many failed attempts (0 means no limit)")
+	deadline  = flag.Duration("deadline", 0, "Give up after this much time has elapsed (0 means no limit)")
+	timeout   = flag.Duration("timeout", 0, "Kill an attempt that runs longer than this (0 means no limit)")
 	beQuiet   = flag.Bool("quiet", false, "Suppress log output")
 )
 
@@ -28,13 +35,39 @@ func init() {
 
 Repeatedly invoke the given command and arguments until it succeeds.  
 
-On error, retry pauses temporarily (with exponential backoff up to --max). and
-tries again.  Errors in starting up the command (for example, due to a missing
-program) are not retried.
+On error, retry pauses temporarily (with backoff up to --max) and tries again.
+Errors in starting up the command (for example, due to a missing program) are
+not retried.
+
+The --backoff strategy sets how the pause grows after each consecutive failure,
+starting from --min:
+
+  exponential    multiply the pause by --factor
+  linear         add (--factor - 1) times --min to the pause
+  constant       always pause for --min
+  fibonacci      pause for --min times 1, 1, 2, 3, 5, 8, ...
+  decorrelated   pause for a random time between --min and --factor times
+                 the previous pause
+
+The --jitter option randomizes each pause, to spread out the retries of many
+concurrent clients: "full" pauses for a random time up to the computed pause,
+and "equal" for half the computed pause plus a random time up to the other
+half. The decorrelated strategy is already random, and does not allow jitter.
 
 If --repeat is set, the command is rerun after each successful completion, with
 an optional delay specified by --pause.
 
+By default, retry tries until the command succeeds or it receives a signal.
+With --attempts, it gives up after that many consecutive failures; with
+--deadline, it gives up once that much time has elapsed since the first of
+them, stopping an attempt still running at the deadline. With --repeat, both
+limits start over after each success. With --timeout, an attempt that runs
+longer than the timeout is killed and counts as a failure.
+
+Exit status is 0 if the command succeeded (or retry was stopped by a signal),
+1 if the command could not be started, 2 if the command line is invalid, and 3
+if retry gave up.
+
 Options:
 `, os.Args[0])
 		flag.PrintDefaults()
@@ -46,19 +79,44 @@ Options:
 const (
 	exitDone    = 0 // command complete
 	exitStartup = 1 // error starting up the command
+	exitUsage   = 2 // invalid command line (as for flag errors)
+	exitGaveUp  = 3 // attempt or time limit reached
 )
 
 func main() {
 	flag.Parse()
 	switch {
 	case *minPoll < 10*time.Millisecond:
-		log.Fatalf("Poll interval must be at least 10ms: %v", *minPoll)
+		usageError("Poll interval must be at least 10ms: %v", *minPoll)
 	case *maxPoll < *minPoll:
-		log.Fatalf("Maximum polling interval is less than minimum: %v < %v", *maxPoll, *minPoll)
+		usageError("Maximum polling interval is less than minimum: %v < %v", *maxPoll, *minPoll)
+	case *factor < 1:
+		usageError("Backoff factor must be at least 1: %v", *factor)
+	case *attempts < 0:
+		usageError("Attempt limit must not be negative: %d", *attempts)
+	case *deadline < 0 || *timeout < 0:
+		usageError("Deadline and timeout must not be negative")
 	case flag.NArg() == 0:
-		log.Fatal("You must provide a command to execute")
+		usageError("You must provide a command to execute")
+	}
+	rng := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	b, err := newBackoff(*backoffBy, *minPoll, *maxPoll, *factor, *jitterBy, rng)
+	if err != nil {
+		usageError("Invalid backoff: %v", err)
 	}
-	os.Exit(run(context.Background()))
+	r := &retrier{
+		name:    flag.Arg(0),
+		attempt: runCommand(flag.Arg(0), flag.Args()[1:]),
+		backoff: b,
+		clock:   realClock{},
+	}
+	os.Exit(r.run(context.Background()))
+}
+
+// usageError logs a message about an invalid command line and exits.
+func usageError(msg string, args ...any) {
+	log.Printf(msg, args...)
+	os.Exit(exitUsage)
 }
 
 func logPrintf(msg string, args ...any) {
@@ -67,41 +125,101 @@ func logPrintf(msg string, args ...any) {
 	}
 }
 
-func run(ctx context.Context) int {
-	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
-	go func() {
-		<-ctx.Done()
-		logPrintf("Signal received; stopping...")
-	}()
+// A clock tells time and waits, so that the retry loop can be tested.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
 
-	cur := *minPoll
-	for {
-		cmd := exec.CommandContext(ctx, flag.Arg(0), flag.Args()[1:]...)
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// A startError reports that the command could not be started.
+type startError struct{ err error }
+
+func (s startError) Error() string { return s.err.Error() }
+
+// runCommand returns a function that runs the named command with args once,
+// and reports whether it succeeded. If the command cannot be started, the
+// function reports a startError.
+func runCommand(name string, args []string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		cmd := exec.CommandContext(ctx, name, args...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-
-		// Try starting the command. If starting the command fails, or if the
-		// command exits unsuccessfully, wait and try again.
 		if err := cmd.Start(); err != nil {
-			logPrintf("ERROR: Starting %q command failed: %v", flag.Arg(0), err)
-			return exitStartup
+			return startError{err}
 		}
 
 		// Tripping the signal handler will kill the subprocess, causing the
 		// Wait call to report an error.
+		return cmd.Wait()
+	}
+}
+
+// A retrier runs a command until it succeeds.
+type retrier struct {
+	name    string                      // the command name, for logs
+	attempt func(context.Context) error // run the command once
+	backoff *backoff                    // pauses after failures
+	clock   clock                       // waits between attempts
+}
+
+func (r *retrier) run(ctx context.Context) int {
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Log a signal, but not the cancellation when run returns. If the log
+	// has already begun, wait for it to finish.
+	signaled := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(signaled)
+		logPrintf("Signal received; stopping...")
+	})
+	defer func() {
+		if !stop() {
+			<-signaled
+		}
+	}()
+
+	var start time.Time // when the current run of failures began
+	var failures int    // the number of consecutive failures
+	for {
+		if failures == 0 {
+			start = r.clock.Now()
+		}
+
+		// Try running the command. If starting the command fails, stop; if
+		// the command exits unsuccessfully, wait and try again unless a limit
+		// has been reached.
 		var waitFor time.Duration
-		if err := cmd.Wait(); err != nil {
-			logPrintf("ERROR: Command %q failed: %v", flag.Arg(0), err)
-			waitFor = cur
-			cur *= 2
-			if cur > *maxPoll {
-				cur = *maxPoll
+		err := r.try(ctx, start)
+		if serr, ok := err.(startError); ok {
+			logPrintf("ERROR: Starting %q command failed: %v", r.name, serr.err)
+			return exitStartup
+		} else if ctx.Err() != nil {
+			return exitDone // stopped by a signal
+		} else if err != nil {
+			failures++
+			logPrintf("ERROR: Command %q failed: %v", r.name, err)
+			if *attempts > 0 && failures >= *attempts {
+				logPrintf("Giving up on %q: reached the limit of %d attempts", r.name, *attempts)
+				return exitGaveUp
+			}
+			waitFor = r.backoff.Next()
+			if *deadline > 0 && r.clock.Now().Add(waitFor).Sub(start) >= *deadline {
+				logPrintf("Giving up on %q after %d attempts: the next would begin after the deadline of %v",
+					r.name, failures, *deadline)
+				return exitGaveUp
 			}
 		} else if !*doRepeat {
 			return exitDone // success, retries disabled
 		} else {
-			cur = *minPoll // reset poll time since we succeeded
+			r.backoff.Reset() // reset poll time since we succeeded
+			failures = 0
 			waitFor = *pauseTime
 		}
 
@@ -109,8 +227,30 @@ func run(ctx context.Context) int {
 		case <-ctx.Done():
 			return exitDone
 
-		case <-time.After(waitFor):
+		case <-r.clock.After(waitFor):
 			// try again...
 		}
 	}
 }
+
+// try runs the command once, subject to the -timeout and to the -deadline of
+// the run of failures beginning at start.
+func (r *retrier) try(ctx context.Context, start time.Time) error {
+	limit, why := *timeout, fmt.Errorf("timed out after %v", *timeout)
+	if *deadline > 0 {
+		left := max(*deadline-r.clock.Now().Sub(start), time.Nanosecond)
+		if limit == 0 || left < limit {
+			limit, why = left, fmt.Errorf("stopped at the deadline of %v", *deadline)
+		}
+	}
+	if limit == 0 {
+		return r.attempt(ctx)
+	}
+	actx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+	err := r.attempt(actx)
+	if err != nil && ctx.Err() == nil && actx.Err() == context.DeadlineExceeded {
+		return why
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// fakeClock records the requested waits, and returns immediately unless ctx
+// has ended. Time advances only by waiting.
+type fakeClock struct {
+	ctx   context.Context
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	if c.ctx.Err() != nil {
+		return nil // never ready
+	}
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// script returns an attempt function that reports each of errs in turn, and
+// cancels the test when they are exhausted.
+func script(cancel context.CancelFunc, errs ...error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if len(errs) == 0 {
+			cancel()
+			return errors.New("canceled")
+		}
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	}
+}
+
+func setGlobal[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+func TestRetrier(t *testing.T) {
+	setGlobal(t, beQuiet, true)
+	failed := errors.New("exit status 1")
+	started := startError{errors.New("no such file")}
+	const s = time.Second
+
+	tests := []struct {
+		name      string
+		repeat    bool
+		errs      []error
+		wantExit  int
+		wantWaits []time.Duration
+	}{
+		{"OK", false, []error{nil}, exitDone, nil},
+		{"Retry", false, []error{failed, failed, failed, nil}, exitDone, []time.Duration{1 * s, 2 * s, 4 * s}},
+		{"StartError", false, []error{failed, started}, exitStartup, []time.Duration{1 * s}},
+		{"Signal", false, []error{failed, failed}, exitDone, []time.Duration{1 * s, 2 * s}},
+		{"Repeat", true, []error{failed, failed, nil, failed, nil}, exitDone,
+			// After a success, pause and restart the backoff.
+			[]time.Duration{1 * s, 2 * s, 5 * s, 1 * s, 5 * s}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setGlobal(t, doRepeat, tc.repeat)
+			setGlobal(t, pauseTime, 5*s)
+			b, err := newBackoff("exponential", s, time.Minute, 2, "none", nil)
+			if err != nil {
+				t.Fatalf("newBackoff: unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			clk := &fakeClock{ctx: ctx}
+			r := &retrier{name: "test", attempt: script(cancel, tc.errs...), backoff: b, clock: clk}
+
+			if got := r.run(ctx); got != tc.wantExit {
+				t.Errorf("Exit code: got %d, want %d", got, tc.wantExit)
+			}
+			if diff := cmp.Diff(tc.wantWaits, clk.waits); diff != "" {
+				t.Errorf("Waits (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	setGlobal(t, beQuiet, true)
+	failed := errors.New("exit status 1")
+	const s = time.Second
+
+	tests := []struct {
+		name      string
+		attempts  int
+		deadline  time.Duration
+		repeat    bool
+		errs      []error
+		wantExit  int
+		wantWaits []time.Duration
+	}{
+		{"Attempts", 3, 0, false, []error{failed, failed, failed, nil}, exitGaveUp, []time.Duration{1 * s, 2 * s}},
+		{"AttemptsOK", 3, 0, false, []error{failed, failed, nil}, exitDone, []time.Duration{1 * s, 2 * s}},
+		{"AttemptsRepeat", 2, 0, true, []error{failed, nil, failed, nil, failed, failed}, exitGaveUp,
+			[]time.Duration{1 * s, 5 * s, 1 * s, 5 * s, 1 * s}},
+
+		// The waits of 1s, 2s and 4s end at 7s, and the next would end at 15s.
+		{"Deadline", 0, 10 * s, false, []error{failed, failed, failed, failed, failed}, exitGaveUp,
+			[]time.Duration{1 * s, 2 * s, 4 * s}},
+		{"DeadlineOK", 0, 10 * s, false, []error{failed, failed, nil}, exitDone, []time.Duration{1 * s, 2 * s}},
+		{"DeadlineRepeat", 0, 4 * s, true, []error{failed, failed, nil, failed, failed, failed}, exitGaveUp,
+			[]time.Duration{1 * s, 2 * s, 5 * s, 1 * s, 2 * s}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setGlobal(t, doRepeat, tc.repeat)
+			setGlobal(t, pauseTime, 5*s)
+			setGlobal(t, attempts, tc.attempts)
+			setGlobal(t, deadline, tc.deadline)
+			b, err := newBackoff("exponential", s, time.Minute, 2, "none", nil)
+			if err != nil {
+				t.Fatalf("newBackoff: unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			clk := &fakeClock{ctx: ctx}
+			r := &retrier{name: "test", attempt: script(cancel, tc.errs...), backoff: b, clock: clk}
+
+			if got := r.run(ctx); got != tc.wantExit {
+				t.Errorf("Exit code: got %d, want %d", got, tc.wantExit)
+			}
+			if diff := cmp.Diff(tc.wantWaits, clk.waits); diff != "" {
+				t.Errorf("Waits (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	setGlobal(t, beQuiet, true)
+	setGlobal(t, attempts, 2)
+	setGlobal(t, timeout, 10*time.Millisecond)
+
+	// Each attempt hangs until it is stopped, and so counts as a failure.
+	var errs []error
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		errs = append(errs, ctx.Err())
+		return errors.New("signal: killed")
+	}
+	b, err := newBackoff("constant", time.Second, time.Second, 1, "none", nil)
+	if err != nil {
+		t.Fatalf("newBackoff: unexpected error: %v", err)
+	}
+	clk := &fakeClock{ctx: t.Context()}
+	r := &retrier{name: "test", attempt: hang, backoff: b, clock: clk}
+	if got := r.run(t.Context()); got != exitGaveUp {
+		t.Errorf("Exit code: got %d, want %d", got, exitGaveUp)
+	}
+	want := []error{context.DeadlineExceeded, context.DeadlineExceeded}
+	if diff := cmp.Diff(want, errs, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("Attempt errors (-want, +got):\n%s", diff)
+	}
+}
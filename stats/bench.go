@@ -0,0 +1,78 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// benchReader reads the results of Go benchmarks, in the format printed by
+// "go test -bench". Each result line gives the name of the benchmark, the
+// number of iterations, and one or more metrics, each a value and a unit:
+//
+//	BenchmarkDecode/small-8   	  500000	  2466 ns/op	  48 B/op	  2 allocs/op
+//
+// For each metric of a result line, benchReader returns a record with the
+// fields named in benchHeader: the name of the benchmark without its
+// GOMAXPROCS suffix ("-8" above), the unit of the metric, and its value.
+// Lines that are not benchmark results are skipped.
+type benchReader struct {
+	textReader
+	next []*record // remaining records for the current line
+}
+
+// benchHeader gives the names of the fields of a benchmark record.
+var benchHeader = map[string]int{"benchmark": 0, "metric": 1, "value": 2}
+
+// benchProcs matches the GOMAXPROCS suffix of a benchmark name.
+var benchProcs = regexp.MustCompile(`-\d+$`)
+
+func (b *benchReader) Next() (*record, error) {
+	for len(b.next) == 0 {
+		rec, err := b.textReader.Next()
+		if err != nil {
+			return nil, err
+		}
+		b.next = parseBench(rec)
+	}
+	rec := b.next[0]
+	b.next = b.next[1:]
+	return rec, nil
+}
+
+// parseBench returns the records for the metrics reported by the benchmark
+// result line in rec, or nil if rec is not a benchmark result. Only the first
+// record has the text of the line, so that it is echoed once by -cat.
+func parseBench(rec *record) []*record {
+	fs := strings.Fields(rec.text)
+	if len(fs) < 4 || len(fs)%2 != 0 || !isBenchName(fs[0]) {
+		return nil
+	} else if _, err := strconv.Atoi(fs[1]); err != nil {
+		return nil // not an iteration count
+	}
+	name := benchProcs.ReplaceAllString(fs[0], "")
+	var out []*record
+	for i := 2; i < len(fs); i += 2 {
+		out = append(out, &record{
+			kind:   csvRecord,
+			line:   rec.line,
+			fields: []string{name, fs[i+1], fs[i]},
+			header: benchHeader,
+		})
+	}
+	out[0].text = rec.text
+	return out
+}
+
+// isBenchName reports whether s is the name of a benchmark: "Benchmark"
+// followed by the end of the string or a character that is not lower case.
+func isBenchName(s string) bool {
+	rest, ok := strings.CutPrefix(s, "Benchmark")
+	if !ok {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return rest == "" || !unicode.IsLower(r)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBenchReader(t *testing.T) {
+	const input = `goos: linux
+goarch: amd64
+BenchmarkDecode/small-8   	  500000	      2466 ns/op	      48 B/op	       2 allocs/op
+BenchmarkEncode
+    encode_test.go:12: some log output
+BenchmarkEncode-16        	 1000000	      1100 ns/op	  90.5 MB/s
+Benchmarked 10 things
+BenchmarkBad-8            	    many	      1100 ns/op
+BenchmarkOdd-8            	     100	      1100 ns/op	  12
+Benchmark-4               	      10	        7 ns/op
+PASS
+ok  	example.com/x	3.2s
+`
+	rr, err := newRecordReader("bench", strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatalf("newRecordReader: %v", err)
+	}
+	var got []string
+	var lines []int
+	for {
+		rec, err := rr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next: unexpected error: %v", err)
+		}
+		var fs []string
+		for _, name := range []string{"benchmark", "metric", "value"} {
+			f, err := rec.Get(column{name: name})
+			if err != nil {
+				t.Fatalf("Get %q: %v", name, err)
+			}
+			fs = append(fs, f)
+		}
+		got = append(got, strings.Join(fs, " "))
+		if rec.text != "" {
+			lines = append(lines, rec.line)
+		}
+	}
+	if diff := cmp.Diff([]string{
+		"BenchmarkDecode/small ns/op 2466",
+		"BenchmarkDecode/small B/op 48",
+		"BenchmarkDecode/small allocs/op 2",
+		"BenchmarkEncode ns/op 1100",
+		"BenchmarkEncode MB/s 90.5",
+		"Benchmark ns/op 7",
+	}, got); diff != "" {
+		t.Errorf("Records (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{3, 6, 10}, lines); diff != "" {
+		t.Errorf("Lines with text (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// plotHeight is the number of rows in the chart drawn by -plot.
+const plotHeight = 10
+
+// writeCharts writes a sparkline (-spark) or chart (-plot) of each field of
+// each group in reports to w. With -time, each chart shows the mean of each
+// time bucket, in order; otherwise it shows the values of the group in the
+// order they were read.
+func (r *reporter) writeCharts(w io.Writer, reports []groupReport, units []unitKind) error {
+	type chart struct {
+		label  string
+		vs     []float64 // NaN for a gap
+		xs     [2]string // labels of the first and last values
+		format func(*big.Rat) string
+	}
+	var charts []chart
+	if r.pick.time != nil {
+		reports = slices.Clone(reports)
+		slices.SortFunc(reports, func(a, b groupReport) int { return slices.Compare(a.key, b.key) })
+		for i := range r.fields {
+			ch := chart{label: fmt.Sprintf("field %s", r.fields[i]), format: units[i].Format}
+			for _, gr := range reports {
+				f := math.NaN()
+				if m := gr.cs[i].Mean(); m != nil {
+					f, _ = m.Float64()
+				}
+				ch.vs = append(ch.vs, f)
+			}
+			if len(reports) != 0 {
+				ch.xs = [2]string{reports[0].key[0], reports[len(reports)-1].key[0]}
+			}
+			charts = append(charts, ch)
+		}
+	} else {
+		for _, gr := range reports {
+			for i, c := range gr.cs {
+				ch := chart{label: histLabel(gr.key, r.fields[i]), format: units[i].Format}
+				for _, v := range c.Values() {
+					ch.vs = append(ch.vs, v.Float())
+				}
+				ch.xs = [2]string{"1", strconv.Itoa(len(ch.vs))}
+				charts = append(charts, ch)
+			}
+		}
+	}
+
+	width := terminalWidth()
+	for _, ch := range charts {
+		if !slices.ContainsFunc(ch.vs, func(f float64) bool { return !math.IsNaN(f) }) {
+			continue // nothing to draw
+		}
+		if len(charts) > 1 || (len(r.keys) != 0 && r.pick.time == nil) {
+			fmt.Fprintf(w, "\n%s:\n", ch.label)
+		}
+		var err error
+		if *doPlot {
+			err = writePlot(w, ch.vs, width, plotHeight, ch.format, ch.xs)
+		} else {
+			_, err = fmt.Fprintln(w, sparkline(resample(ch.vs, width)))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resample returns vs reduced to at most n values, by replacing consecutive
+// runs of values by their mean, ignoring NaN.
+func resample(vs []float64, n int) []float64 {
+	if len(vs) <= n {
+		return vs
+	}
+	out := make([]float64, n)
+	for i := range out {
+		lo, hi := i*len(vs)/n, (i+1)*len(vs)/n
+		var sum float64
+		var count int
+		for _, v := range vs[lo:hi] {
+			if !math.IsNaN(v) {
+				sum += v
+				count++
+			}
+		}
+		out[i] = sum / float64(count) // NaN if count == 0
+	}
+	return out
+}
+
+// span returns the least and greatest values of vs, ignoring NaN.
+func span(vs []float64) (lo, hi float64) {
+	lo, hi = math.Inf(1), math.Inf(-1)
+	for _, v := range vs {
+		if !math.IsNaN(v) {
+			lo, hi = min(lo, v), max(hi, v)
+		}
+	}
+	return lo, hi
+}
+
+// scale returns the position of v in [lo, hi] as an integer from 0 to n-1.
+func scale(v, lo, hi float64, n int) int {
+	if hi <= lo {
+		return 0
+	}
+	return min(int((v-lo)/(hi-lo)*float64(n)), n-1)
+}
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline returns a line of block characters whose heights are scaled to
+// the values in vs, with a space for NaN.
+func sparkline(vs []float64) string {
+	lo, hi := span(vs)
+	var sb strings.Builder
+	for _, v := range vs {
+		if math.IsNaN(v) {
+			sb.WriteByte(' ')
+		} else {
+			sb.WriteRune(sparkRunes[scale(v, lo, hi, len(sparkRunes))])
+		}
+	}
+	return sb.String()
+}
+
+// writePlot draws vs to w as a line chart of the given number of rows, fitted
+// to width columns. The vertical axis is labelled with the least and greatest
+// values, formatted using format, and the horizontal axis with the labels of
+// the first and last values in xs.
+func writePlot(w io.Writer, vs []float64, width, height int, format func(*big.Rat) string, xs [2]string) error {
+	lo, hi := span(vs)
+	labels := [2]string{format(ratFloat(hi)), format(ratFloat(lo))}
+	wlabel := max(utf8.RuneCountInString(labels[0]), utf8.RuneCountInString(labels[1]))
+	vs = resample(vs, max(width-wlabel-2, 10))
+
+	// Mark the row of each value, and join the rows of adjacent values with
+	// a vertical line so that the chart reads as a line.
+	grid := make([][]byte, height)
+	for i := range grid {
+		grid[i] = []byte(strings.Repeat(" ", len(vs)))
+	}
+	prev := -1
+	for x, v := range vs {
+		if math.IsNaN(v) {
+			prev = -1
+			continue
+		}
+		y := height - 1 - scale(v, lo, hi, height)
+		if prev >= 0 {
+			for j := min(prev, y) + 1; j < max(prev, y); j++ {
+				grid[j][x] = '|'
+			}
+		}
+		grid[y][x] = '*'
+		prev = y
+	}
+
+	for i, row := range grid {
+		var label string
+		switch i {
+		case 0:
+			label = labels[0]
+		case height - 1:
+			label = labels[1]
+		}
+		if _, err := fmt.Fprintf(w, "%*s |%s\n", wlabel, label, strings.TrimRight(string(row), " ")); err != nil {
+			return err
+		}
+	}
+	pad := max(len(vs)-utf8.RuneCountInString(xs[0])-utf8.RuneCountInString(xs[1]), 1)
+	_, err := fmt.Fprintf(w, "%*s +%s\n%*s  %s%*s\n", wlabel, "", strings.Repeat("-", len(vs)),
+		wlabel, "", xs[0], pad+utf8.RuneCountInString(xs[1]), xs[1])
+	return err
+}
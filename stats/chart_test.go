@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSparkline(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		vs   []float64
+		want string
+	}{
+		{nil, ""},
+		{[]float64{5, 5}, "▁▁"},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8}, "▁▂▃▄▅▆▇█"},
+		{[]float64{0, nan, 10}, "▁ █"},
+	}
+	for _, tc := range tests {
+		if got := sparkline(tc.vs); got != tc.want {
+			t.Errorf("sparkline(%v): got %q, want %q", tc.vs, got, tc.want)
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	nan := math.NaN()
+	got := resample([]float64{1, 3, nan, nan, 5, nan, 2, 4}, 4)
+	want := []float64{2, nan, 5, 3}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b float64) bool {
+		return a == b || math.IsNaN(a) && math.IsNaN(b)
+	})); diff != "" {
+		t.Errorf("resample (-want, +got):\n%s", diff)
+	}
+}
+
+func TestWritePlot(t *testing.T) {
+	var buf bytes.Buffer
+	vs := []float64{1, 4, 2, math.NaN(), 3}
+	if err := writePlot(&buf, vs, 20, 4, ratString, [2]string{"a", "z"}); err != nil {
+		t.Fatalf("writePlot: %v", err)
+	}
+	const want = `4 | *
+  | || *
+  | |*
+1 |*
+  +-----
+   a   z
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("writePlot (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+// compare writes a report comparing the statistics in two sets of groups,
+// read from the input files with the given names. The summaries of the two
+// sets are written side by side, as a table with an extra "file" key column,
+// followed by a comparison of each group and field present in either set.
+func (r *reporter) compare(w io.Writer, names [2]string, sets [2]*groupSet) error {
+	units := r.pick.Units()
+	var reps [2]map[string]groupReport
+	for i, gs := range sets {
+		rs, err := gs.Report(r.pcts, units, "key", 0)
+		if err != nil {
+			return err
+		}
+		reps[i] = make(map[string]groupReport)
+		for _, gr := range rs {
+			reps[i][strings.Join(gr.key, "\x00")] = gr
+		}
+	}
+
+	// Order groups by key, whichever set they appear in.
+	var ids []string
+	for _, m := range reps {
+		for id := range m {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return slices.Compare(strings.Split(a, "\x00"), strings.Split(b, "\x00"))
+	})
+
+	var sums, cmps []groupReport
+	for _, id := range ids {
+		var key []string
+		var cs [2][]*collector
+		for i, m := range reps {
+			gr, ok := m[id]
+			if !ok {
+				continue
+			}
+			key, cs[i] = gr.key, gr.cs
+			sums = append(sums, groupReport{
+				group:   &group{key: append([]string{names[i]}, gr.key...), cs: gr.cs},
+				results: gr.results,
+			})
+		}
+		cmp := groupReport{group: &group{key: key}, results: make([][]result, len(r.fields))}
+		for j := range r.fields {
+			var a, b *collector
+			if cs[0] != nil {
+				a = cs[0][j]
+			}
+			if cs[1] != nil {
+				b = cs[1][j]
+			}
+			cmp.results[j] = compareResults(a, b, units[j])
+		}
+		cmps = append(cmps, cmp)
+	}
+
+	fileKeys := append([]column{{name: "file"}}, r.keys...)
+	if err := writeReport(w, *outFormat, sums, r.fields, fileKeys); err != nil {
+		return err
+	}
+	if *outFormat != "json" {
+		fmt.Fprintln(w)
+	}
+	return writeReport(w, *outFormat, cmps, r.fields, r.keys)
+}
+
+// compareResults returns the results of comparing the values in a and b,
+// either of which may be nil if the group did not occur in that input.
+// The results are the difference of the means (b - a) and the relative
+// change, Welch's t-test, and the Mann-Whitney U test.
+func compareResults(a, b *collector, unit unitKind) []result {
+	delta, change := math.NaN(), math.NaN()
+	t, p, u, up := math.NaN(), math.NaN(), math.NaN(), math.NaN()
+	if a != nil && b != nil && a.Count() != 0 && b.Count() != 0 {
+		ma, _ := a.Mean().Float64()
+		mb, _ := b.Mean().Float64()
+		delta = mb - ma
+		if ma != 0 {
+			change = 100 * delta / math.Abs(ma)
+		}
+		if a.Count() >= 2 && b.Count() >= 2 {
+			va, _ := a.Var().Float64()
+			vb, _ := b.Var().Float64()
+			t, _, p = welchTest(ma, va, float64(a.Count()), mb, vb, float64(b.Count()))
+		}
+		u, up = mannWhitney(a.Values(), b.Values())
+	}
+	approx := func(key string, f float64, unit unitKind) result {
+		v := ratFloat(f)
+		if v == nil {
+			return result{key: key, value: "-"} // not "0", which looks significant
+		}
+		return result{key: key, value: unit.Format(v), num: v, approx: true}
+	}
+	pvalue := func(key string, f float64) result {
+		r := approx(key, f, noUnit)
+		if r.num != nil {
+			r.value = fmt.Sprintf("%.3g", f) // p-values need significant digits, not -prec
+		}
+		return r
+	}
+	return []result{
+		approx("delta", delta, unit),
+		approx("change", change, percentUnit),
+		approx("welch_t", t, noUnit),
+		pvalue("welch_p", p),
+		approx("mwu_u", u, noUnit),
+		pvalue("mwu_p", up),
+	}
+}
+
+// welchTest performs Welch's unequal-variances t-test for the difference of
+// the means of two samples, given the mean, variance, and size of each. It
+// returns the t statistic, the Welch-Satterthwaite degrees of freedom, and
+// the two-sided p-value, or NaN for each if the test is not defined.
+func welchTest(m1, v1, n1, m2, v2, n2 float64) (t, df, p float64) {
+	s1, s2 := v1/n1, v2/n2
+	if s1+s2 == 0 {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+	t = (m2 - m1) / math.Sqrt(s1+s2)
+	df = (s1 + s2) * (s1 + s2) / (s1*s1/(n1-1) + s2*s2/(n2-1))
+	p = 2 * studentTCDF(-math.Abs(t), df)
+	return t, df, p
+}
+
+// mannWhitney performs the Mann-Whitney U (Wilcoxon rank-sum) test of
+// whether values in a and b are drawn from the same distribution. It returns
+// the U statistic for a, and the two-sided p-value by the normal
+// approximation, with corrections for ties and continuity. It returns NaN
+// for the p-value if all the values are equal.
+func mannWhitney(a, b []value) (u, p float64) {
+	type obs struct {
+		v     value
+		fromA bool
+	}
+	all := make([]obs, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range b {
+		all = append(all, obs{v, false})
+	}
+	slices.SortFunc(all, func(x, y obs) int { return x.v.Cmp(y.v) })
+
+	// Assign each run of tied values the average of their ranks, and sum the
+	// ranks of the values from a.
+	var rankA, ties float64
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].v.Cmp(all[i].v) == 0 {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // average of ranks i+1 through j
+		for _, o := range all[i:j] {
+			if o.fromA {
+				rankA += rank
+			}
+		}
+		nt := float64(j - i)
+		ties += nt*nt*nt - nt
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+	u = rankA - n1*(n1+1)/2
+
+	mu := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 || math.IsNaN(sigma) {
+		return u, math.NaN()
+	}
+	z := math.Max(math.Abs(u-mu)-0.5, 0) / sigma
+	return u, math.Erfc(z / math.Sqrt2)
+}
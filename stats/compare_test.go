@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/creachadair/misctools/stats/summary"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWelchTest(t *testing.T) {
+	// Example 1 from the Wikipedia article on Welch's t-test.
+	a := []float64{27.5, 21.0, 19.0, 23.6, 17.0, 17.9, 16.9, 20.1, 21.9, 22.6, 23.1, 19.6, 19.0, 21.7, 21.4}
+	b := []float64{27.1, 22.0, 20.8, 23.4, 23.4, 23.5, 25.8, 22.0, 24.8, 20.2, 21.9, 22.1, 22.9, 20.5, 24.4}
+	var sa, sb summary.Float
+	for i := range a {
+		sa.Add(a[i])
+		sb.Add(b[i])
+	}
+	tv, df, p := welchTest(sa.Mean(), sa.Var(), 15, sb.Mean(), sb.Var(), 15)
+	for _, c := range []struct {
+		name      string
+		got, want float64
+		tolerance float64
+	}{
+		{"t", tv, 2.46, 0.005},
+		{"df", df, 24.99, 0.005},
+		{"p", p, 0.021, 0.0005},
+	} {
+		if math.Abs(c.got-c.want) > c.tolerance {
+			t.Errorf("Welch %s: got %.4f, want %.4f", c.name, c.got, c.want)
+		}
+	}
+
+	if _, _, p := welchTest(5, 0, 3, 6, 0, 3); !math.IsNaN(p) {
+		t.Errorf("Welch with zero variance: got p=%v, want NaN", p)
+	}
+}
+
+func TestMannWhitney(t *testing.T) {
+	floats := func(fs ...float64) []value {
+		out := make([]value, len(fs))
+		for i, f := range fs {
+			out[i] = floatValue(f)
+		}
+		return out
+	}
+	tests := []struct {
+		name  string
+		a, b  []value
+		u, p  float64
+		undef bool
+	}{
+		{"Separated", floats(1, 2, 3, 4, 5), floats(6, 7, 8, 9, 10), 0, 0.012186, false},
+		{"Reversed", floats(6, 7, 8, 9, 10), floats(1, 2, 3, 4, 5), 25, 0.012186, false},
+		{"Ties", floats(1, 2, 2, 3, 7), floats(2, 3, 4, 5, 5, 6), 8.5, 0.266699, false},
+		{"AllEqual", floats(4, 4), floats(4, 4, 4), 3, 0, true},
+	}
+	for _, tc := range tests {
+		u, p := mannWhitney(tc.a, tc.b)
+		if u != tc.u {
+			t.Errorf("%s: U: got %v, want %v", tc.name, u, tc.u)
+		}
+		if tc.undef {
+			if !math.IsNaN(p) {
+				t.Errorf("%s: p: got %v, want NaN", tc.name, p)
+			}
+		} else if math.Abs(p-tc.p) > 1e-6 {
+			t.Errorf("%s: p: got %.6f, want %.6f", tc.name, p, tc.p)
+		}
+	}
+}
+
+func TestCompareReport(t *testing.T) {
+	setFlags(t, "mean", "true")
+	sets := [2]*groupSet{
+		newGroupSet(1, collectOptions{retain: true}),
+		newGroupSet(1, collectOptions{retain: true}),
+	}
+	add := func(i int, key string, fs ...float64) {
+		for _, f := range fs {
+			sets[i].Add([]string{key}, []value{floatValue(f)})
+		}
+	}
+	// Example 1 from the Wikipedia article on Welch's t-test, for which the
+	// reference values are t = 2.46 and p = 0.021. The Mann-Whitney reference
+	// values, with corrections for ties and continuity, are U = 53.5 and
+	// p = 0.0152.
+	add(0, "a", 27.5, 21.0, 19.0, 23.6, 17.0, 17.9, 16.9, 20.1, 21.9, 22.6, 23.1, 19.6, 19.0, 21.7, 21.4)
+	add(1, "a", 27.1, 22.0, 20.8, 23.4, 23.4, 23.5, 25.8, 22.0, 24.8, 20.2, 21.9, 22.1, 22.9, 20.5, 24.4)
+
+	// With constant values, the tests are not defined, except for U.
+	add(0, "b", 4, 4, 4)
+	add(1, "b", 4, 4)
+
+	// A group in only one input cannot be compared.
+	add(0, "c", 1, 2)
+
+	fields, keys := []column{{index: 2}}, []column{{index: 1}}
+	rep := &reporter{pick: newPicker(fields, keys, noUnit, false), fields: fields, keys: keys}
+	var buf bytes.Buffer
+	if err := rep.compare(&buf, [2]string{"old", "new"}, sets); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	const want = `  file  f1   n   avg
+   old   a  15  20.8
+   new   a  15  23.0
+   old   b   3     4
+   new   b   2     4
+   old   c   2   1.5
+
+  f1  delta  change  welch_t  welch_p  mwu_u   mwu_p
+   a    2.2   10.4%      2.5   0.0214   53.5  0.0152
+   b      0      0%        -        -      3       -
+   c      -       -        -        -      -       -
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Compare report (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"math"
+	"math/big"
+	"math/bits"
+	"slices"
+	"strconv"
+)
+
+// A freqCounter counts the occurrences of distinct text values.
+type freqCounter interface {
+	// Add adds one occurrence of s.
+	Add(s string)
+
+	// Total returns the total number of occurrences added.
+	Total() int64
+
+	// Distinct returns the number of distinct values added. If approx is
+	// true, the number is an estimate.
+	Distinct() (n int64, approx bool)
+
+	// Top returns the k most frequent values, or all values if k == 0, in
+	// decreasing order of count, with ties ordered by value.
+	Top(k int) []freq
+
+	// Merge adds the values from another freqCounter of the same kind.
+	Merge(freqCounter)
+}
+
+// A freq is a value and the number of times it occurred. If the count is an
+// estimate, it may overcount by at most err.
+type freq struct {
+	value      string
+	count, err int64
+}
+
+func compareFreq(a, b freq) int {
+	return cmp.Or(cmp.Compare(b.count, a.count), cmp.Compare(a.value, b.value))
+}
+
+// newFreqCounter returns a freqCounter that counts every distinct value if
+// stream is false, or a bounded-memory estimator that can report the k most
+// frequent values otherwise.
+func newFreqCounter(stream bool, k int) freqCounter {
+	if !stream {
+		return &exactCounter{counts: make(map[string]int64)}
+	}
+	return &sketchCounter{hll: newHLL(hllPrecision), top: newSpaceSaving(max(10*k, 100))}
+}
+
+// exactCounter counts values exactly by retaining every distinct value.
+type exactCounter struct {
+	counts map[string]int64
+	total  int64
+}
+
+func (e *exactCounter) Add(s string) { e.counts[s]++; e.total++ }
+
+func (e *exactCounter) Total() int64 { return e.total }
+
+func (e *exactCounter) Distinct() (int64, bool) { return int64(len(e.counts)), false }
+
+func (e *exactCounter) Top(k int) []freq {
+	out := make([]freq, 0, len(e.counts))
+	for s, n := range e.counts {
+		out = append(out, freq{value: s, count: n})
+	}
+	slices.SortFunc(out, compareFreq)
+	if k > 0 && len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+func (e *exactCounter) Merge(o freqCounter) {
+	oc := o.(*exactCounter)
+	for s, n := range oc.counts {
+		e.counts[s] += n
+	}
+	e.total += oc.total
+}
+
+// sketchCounter estimates the number of distinct values with a HyperLogLog
+// sketch, and the most frequent values with a Space-Saving sketch.
+type sketchCounter struct {
+	hll   *hll
+	top   *spaceSaving
+	total int64
+}
+
+func (s *sketchCounter) Add(v string) {
+	s.hll.Add(v)
+	s.top.Add(v)
+	s.total++
+}
+
+func (s *sketchCounter) Total() int64 { return s.total }
+
+func (s *sketchCounter) Distinct() (int64, bool) { return s.hll.Estimate(), true }
+
+func (s *sketchCounter) Top(k int) []freq { return s.top.Top(k) }
+
+func (s *sketchCounter) Merge(o freqCounter) {
+	oc := o.(*sketchCounter)
+	s.hll.Merge(oc.hll)
+	s.top.Merge(oc.top)
+	s.total += oc.total
+}
+
+// hllPrecision is the number of bits of the hash used to select a register
+// of the HyperLogLog sketch. The sketch has 2^hllPrecision registers, and
+// the relative standard error of its estimates is about 1.04/√(2^p), or 0.8%.
+const hllPrecision = 14
+
+// An hll is a HyperLogLog sketch, which estimates the number of distinct
+// values added to it using a fixed amount of memory. See Flajolet et al.,
+// "HyperLogLog: the analysis of a near-optimal cardinality estimation
+// algorithm" (2007).
+type hll struct {
+	p   uint8
+	reg []uint8 // the maximum rank seen for each register
+}
+
+func newHLL(p uint8) *hll { return &hll{p: p, reg: make([]uint8, 1<<p)} }
+
+// Add adds s to the sketch.
+func (h *hll) Add(s string) {
+	x := hashString(s)
+	i := x >> (64 - h.p)
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1)) + 1)
+	h.reg[i] = max(h.reg[i], rank)
+}
+
+// Merge adds the contents of o, which must have the same precision, to h.
+func (h *hll) Merge(o *hll) {
+	for i, r := range o.reg {
+		h.reg[i] = max(h.reg[i], r)
+	}
+}
+
+// Estimate returns the estimated number of distinct values added to h.
+func (h *hll) Estimate() int64 {
+	m := float64(len(h.reg))
+	var sum float64
+	var zeros int
+	for _, r := range h.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros)) // linear counting for small sets
+	}
+	return int64(math.Round(est))
+}
+
+// hashString returns a 64-bit hash of s. The hash is FNV-1a, followed by the
+// finalizer of MurmurHash3 to mix the high bits, on which HyperLogLog relies.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	io.WriteString(h, s)
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// A spaceSaving sketch estimates the most frequent values using a fixed
+// number of counters. Every value that occurs more than n/size times among n
+// values is retained, and its count overestimates the true count by at most
+// the error recorded with it. See Metwally et al., "Efficient computation of
+// frequent and top-k elements in data streams" (2005).
+type spaceSaving struct {
+	size  int
+	index map[string]*ssEntry
+	heap  ssHeap // ordered by count, least first
+}
+
+type ssEntry struct {
+	freq
+	pos int // position in the heap
+}
+
+func newSpaceSaving(size int) *spaceSaving {
+	return &spaceSaving{size: size, index: make(map[string]*ssEntry)}
+}
+
+// Add adds one occurrence of s. If s is not counted and all the counters are
+// in use, s replaces the least frequent value, and inherits its count as the
+// error of its own count.
+func (t *spaceSaving) Add(s string) {
+	if e, ok := t.index[s]; ok {
+		e.count++
+		heap.Fix(&t.heap, e.pos)
+		return
+	}
+	if len(t.heap) < t.size {
+		e := &ssEntry{freq: freq{value: s, count: 1}}
+		t.index[s] = e
+		heap.Push(&t.heap, e)
+		return
+	}
+	e := t.heap[0]
+	delete(t.index, e.value)
+	e.value, e.err = s, e.count
+	e.count++
+	t.index[s] = e
+	heap.Fix(&t.heap, 0)
+}
+
+// min returns the least count retained by t, which bounds the count of any
+// value it does not retain, or 0 if t is not full.
+func (t *spaceSaving) min() int64 {
+	if len(t.heap) < t.size {
+		return 0
+	}
+	return t.heap[0].count
+}
+
+// Merge adds the values counted by o to t. A value counted by only one of
+// the sketches may have occurred up to the least count of the other as well.
+func (t *spaceSaving) Merge(o *spaceSaving) {
+	tmin, omin := t.min(), o.min()
+	all := make(map[string]freq)
+	for s, e := range t.index {
+		all[s] = freq{value: s, count: e.count + omin, err: e.err + omin}
+	}
+	for s, e := range o.index {
+		if f, ok := all[s]; ok {
+			f.count += e.count - omin
+			f.err += e.err - omin
+			all[s] = f
+		} else {
+			all[s] = freq{value: s, count: e.count + tmin, err: e.err + tmin}
+		}
+	}
+	fs := slices.SortedFunc(maps.Values(all), compareFreq)
+	if len(fs) > t.size {
+		fs = fs[:t.size]
+	}
+	t.index = make(map[string]*ssEntry, len(fs))
+	t.heap = t.heap[:0]
+	for _, f := range fs {
+		e := &ssEntry{freq: f}
+		t.index[f.value] = e
+		heap.Push(&t.heap, e)
+	}
+}
+
+// Top returns the k values with the greatest counts, or all values if k == 0.
+func (t *spaceSaving) Top(k int) []freq {
+	out := make([]freq, len(t.heap))
+	for i, e := range t.heap {
+		out[i] = e.freq
+	}
+	slices.SortFunc(out, compareFreq)
+	if k > 0 && len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+// ssHeap is a min-heap of counters, implementing heap.Interface.
+type ssHeap []*ssEntry
+
+func (h ssHeap) Len() int           { return len(h) }
+func (h ssHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h ssHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos, h[j].pos = i, j
+}
+
+func (h *ssHeap) Push(x any) {
+	e := x.(*ssEntry)
+	e.pos = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *ssHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// countLimit returns the number of most frequent values to report for each
+// group with -count, or 0 for all values. The sketch used with -stream can
+// report only a limited number, 10 unless -values is set.
+func countLimit() int {
+	if *countValues == 0 && *doStream {
+		return 10
+	}
+	return *countValues
+}
+
+// writeCounts writes the most frequent values of each group in reports to
+// w, in the output format selected by -o, following the summaries.
+func (r *reporter) writeCounts(w io.Writer, reports []groupReport) error {
+	k := countLimit()
+	var rows []groupReport
+	for _, gr := range reports {
+		c := gr.cs[0]
+		n := c.Count()
+		for _, f := range c.freq.Top(k) {
+			pct := new(big.Rat).SetFrac64(100*f.count, n)
+			rs := []result{
+				{key: "count", value: strconv.FormatInt(f.count, 10), num: big.NewRat(f.count, 1)},
+				{key: "pct", value: percentUnit.Format(pct), num: pct},
+			}
+			if *doStream {
+				rs = append(rs, result{key: "err", value: strconv.FormatInt(f.err, 10), num: big.NewRat(f.err, 1)})
+			}
+			rows = append(rows, groupReport{
+				group:   &group{key: append(slices.Clone(gr.key), f.value)},
+				results: [][]result{rs},
+			})
+		}
+	}
+	if *outFormat != "json" {
+		fmt.Fprintln(w)
+	}
+	return writeReport(w, *outFormat, rows, r.fields, append(slices.Clone(r.keys), column{name: "value"}))
+}
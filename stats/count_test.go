@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExactCounter(t *testing.T) {
+	a, b := newFreqCounter(false, 0), newFreqCounter(false, 0)
+	for _, s := range []string{"GET", "PUT", "GET", "HEAD"} {
+		a.Add(s)
+	}
+	for _, s := range []string{"PUT", "POST", "GET"} {
+		b.Add(s)
+	}
+	a.Merge(b)
+
+	if got := a.Total(); got != 7 {
+		t.Errorf("Total: got %d, want 7", got)
+	}
+	if n, approx := a.Distinct(); n != 4 || approx {
+		t.Errorf("Distinct: got %d, %v; want 4, false", n, approx)
+	}
+	want := []freq{{value: "GET", count: 3}, {value: "PUT", count: 2}, {value: "HEAD", count: 1}}
+	if diff := cmp.Diff(want, a.Top(3), cmp.AllowUnexported(freq{})); diff != "" {
+		t.Errorf("Top(3) (-want, +got):\n%s", diff)
+	}
+	if got := len(a.Top(0)); got != 4 {
+		t.Errorf("Top(0): got %d values, want 4", got)
+	}
+}
+
+func TestCountReport(t *testing.T) {
+	setFlags(t, "top", "2", "values", "1")
+	gs := newGroupSet(1, collectOptions{count: true})
+	for _, kv := range [][2]string{
+		{"a", "x"}, {"a", "y"}, {"a", "y"}, {"b", "x"}, {"b", "z"}, {"b", "z"}, {"c", "q"},
+	} {
+		gs.AddText([]string{kv[0]}, kv[1])
+	}
+
+	// The -top flag limits the groups, and -values the values listed for each.
+	fields, keys := []column{{index: 2}}, []column{{index: 1}}
+	p := newPicker(fields, keys, noUnit, false)
+	p.count = true
+	rep := &reporter{pick: p, fields: fields, keys: keys}
+	var buf bytes.Buffer
+	if err := rep.write(&buf, gs); err != nil {
+		t.Fatalf("Write report: %v", err)
+	}
+	const want = `  f1  n  distinct
+   a  3         2
+   b  3         2
+
+  f1  value  count    pct
+   a      y      2  66.7%
+   b      z      2  66.7%
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Count report (-want, +got):\n%s", diff)
+	}
+}
+
+func TestHLL(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		h := newHLL(hllPrecision)
+		for i := range n {
+			h.Add(fmt.Sprintf("value-%d", i))
+			h.Add(fmt.Sprintf("value-%d", i/2)) // duplicates do not count
+		}
+		if got := h.Estimate(); math.Abs(float64(got)-float64(n)) > 0.03*float64(n) {
+			t.Errorf("Estimate of %d: got %d", n, got)
+		}
+	}
+
+	// Merging sketches of overlapping sets estimates their union.
+	a, b := newHLL(hllPrecision), newHLL(hllPrecision)
+	for i := range 60000 {
+		a.Add(fmt.Sprint(i))
+		b.Add(fmt.Sprint(i + 40000))
+	}
+	a.Merge(b)
+	if got := a.Estimate(); math.Abs(float64(got)-100000) > 3000 {
+		t.Errorf("Estimate of union: got %d, want about 100000", got)
+	}
+}
+
+func TestSpaceSaving(t *testing.T) {
+	// Value i occurs i times among many values that occur once, so the heavy
+	// values should be found, with counts at most err too high.
+	add := func(s *spaceSaving, lo, hi int) {
+		for i := lo; i < hi; i++ {
+			s.Add(fmt.Sprintf("rare-%d", i))
+			if i%10 == 0 {
+				for range i / 10 {
+					s.Add(fmt.Sprintf("heavy-%d", i/10))
+				}
+			}
+		}
+	}
+	check := func(name string, s *spaceSaving) {
+		top := s.Top(5)
+		for i, f := range top {
+			want := fmt.Sprintf("heavy-%d", 199-i)
+			if f.value != want {
+				t.Errorf("%s: top %d: got %q, want %q", name, i, f.value, want)
+			} else if n := int64(199 - i); f.count < n || f.count-f.err > n {
+				t.Errorf("%s: %s: count %d (err %d) does not bound %d", name, f.value, f.count, f.err, n)
+			}
+		}
+	}
+
+	one := newSpaceSaving(100)
+	add(one, 0, 2000)
+	check("Single", one)
+
+	a, b := newSpaceSaving(100), newSpaceSaving(100)
+	add(a, 0, 1000)
+	add(b, 1000, 2000)
+	a.Merge(b)
+	check("Merged", a)
+}
@@ -0,0 +1,93 @@
+package main
+
+import "math"
+
+// studentTCDF returns the probability that a random variable with Student's t
+// distribution with df degrees of freedom is at most t.
+func studentTCDF(t, df float64) float64 {
+	// P(|T| > |t|) = I_x(df/2, 1/2), where x = df/(df+t²).
+	p := regIncBeta(df/2, 0.5, df/(df+t*t)) / 2
+	if t > 0 {
+		return 1 - p
+	}
+	return p
+}
+
+// studentTQuantile returns the value t such that studentTCDF(t, df) = p,
+// for 0 < p < 1.
+func studentTQuantile(p, df float64) float64 {
+	if p < 0.5 {
+		return -studentTQuantile(1-p, df)
+	} else if p == 0.5 {
+		return 0
+	}
+	// The CDF is monotonic, so bracket the answer and bisect.
+	lo, hi := 0.0, 1.0
+	for studentTCDF(hi, df) < p {
+		lo, hi = hi, hi*2
+	}
+	for range 100 {
+		mid := (lo + hi) / 2
+		if studentTCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// regIncBeta returns the regularized incomplete beta function Iₓ(a, b), for
+// 0 ≤ x ≤ 1, using the continued fraction from Numerical Recipes §6.4.
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	} else if x >= 1 {
+		return 1
+	}
+	lab, _ := math.Lgamma(a + b)
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log1p(-x))
+
+	// The continued fraction converges rapidly only for x < (a+1)/(a+b+2);
+	// otherwise use the symmetry Iₓ(a, b) = 1 - I₁₋ₓ(b, a).
+	if x < (a+1)/(a+b+2) {
+		return front * betaFrac(a, b, x) / a
+	}
+	return 1 - front*betaFrac(b, a, 1-x)/b
+}
+
+// betaFrac evaluates the continued fraction for the incomplete beta function
+// by the modified Lentz method.
+func betaFrac(a, b, x float64) float64 {
+	const tiny = 1e-300
+	const eps = 1e-15
+
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1.0; m <= 300; m++ {
+		// Even step.
+		num := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d, c = 1+num*d, 1+num/c
+		d = 1 / max(math.Abs(d), tiny) * math.Copysign(1, d)
+		c = max(math.Abs(c), tiny) * math.Copysign(1, c)
+		h *= d * c
+
+		// Odd step.
+		num = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d, c = 1+num*d, 1+num/c
+		d = 1 / max(math.Abs(d), tiny) * math.Copysign(1, d)
+		c = max(math.Abs(c), tiny) * math.Copysign(1, c)
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
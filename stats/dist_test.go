@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStudentT(t *testing.T) {
+	// Critical values from standard tables.
+	tests := []struct {
+		p, df, want float64
+	}{
+		{0.975, 1, 12.7062},
+		{0.975, 2, 4.3027},
+		{0.975, 10, 2.2281},
+		{0.995, 30, 2.7500},
+		{0.95, 5, 2.0150},
+		{0.975, 1e6, 1.9600},
+		{0.025, 10, -2.2281},
+		{0.5, 3, 0},
+	}
+	for _, tc := range tests {
+		got := studentTQuantile(tc.p, tc.df)
+		if math.Abs(got-tc.want) > 1e-4 {
+			t.Errorf("studentTQuantile(%v, %v): got %.5f, want %.4f", tc.p, tc.df, got, tc.want)
+		}
+		if tc.p != 0.5 {
+			if cdf := studentTCDF(got, tc.df); math.Abs(cdf-tc.p) > 1e-9 {
+				t.Errorf("studentTCDF(%v, %v): got %v, want %v", got, tc.df, cdf, tc.p)
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// An expr is an arithmetic expression over the fields of a record, evaluated
+// with exact rational arithmetic.
+//
+// The grammar is:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = [ "+" | "-" ] unary | primary
+//	primary = number | field | name "(" expr { "," expr } ")" | "(" expr ")"
+//	field   = "$" digits | "${" name "}"
+//
+// A field is given by its 1-based position ($0 is the entire record), or by
+// a name, such as a CSV column name or JSON path. The functions are abs,
+// min, max, and log (the natural logarithm, which is computed in float64).
+type expr struct {
+	src  string
+	cols []column // the fields referenced, each once
+	eval func(vals []*big.Rat) (*big.Rat, error)
+}
+
+type exprFunc = func(vals []*big.Rat) (*big.Rat, error)
+
+// parseExpr parses an expression from src.
+func parseExpr(src string) (*expr, error) {
+	p := &exprParser{src: src}
+	f, err := p.parseSum()
+	if err == nil && p.skipSpace() < len(src) {
+		err = p.errorf("unexpected %q", src[p.pos:])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &expr{src: src, cols: p.cols, eval: f}, nil
+}
+
+func (e *expr) String() string { return e.src }
+
+// Eval evaluates e for the fields of rec.
+func (e *expr) Eval(rec *record) (*big.Rat, error) {
+	vals := make([]*big.Rat, len(e.cols))
+	for i, c := range e.cols {
+		s, err := rec.Get(c)
+		if err != nil {
+			return nil, err
+		}
+		v, err := parseValue(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("field $%s: %w", c, err)
+		}
+		vals[i] = v
+	}
+	return e.eval(vals)
+}
+
+type exprParser struct {
+	src  string
+	pos  int
+	cols []column
+}
+
+func (p *exprParser) errorf(msg string, args ...any) error {
+	return fmt.Errorf("at offset %d: %s", p.pos, fmt.Sprintf(msg, args...))
+}
+
+// skipSpace advances past whitespace and returns the new position.
+func (p *exprParser) skipSpace() int {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos
+}
+
+// accept reports whether the next token is the punctuation c, and if so
+// consumes it.
+func (p *exprParser) accept(c byte) bool {
+	if p.skipSpace() < len(p.src) && p.src[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseSum() (exprFunc, error) {
+	lhs, err := p.parseTerm()
+	for err == nil {
+		var op func(z, x, y *big.Rat) *big.Rat
+		if p.accept('+') {
+			op = (*big.Rat).Add
+		} else if p.accept('-') {
+			op = (*big.Rat).Sub
+		} else {
+			break
+		}
+		var rhs exprFunc
+		rhs, err = p.parseTerm()
+		lhs = binary(lhs, rhs, func(x, y *big.Rat) (*big.Rat, error) {
+			return op(new(big.Rat), x, y), nil
+		})
+	}
+	return lhs, err
+}
+
+func (p *exprParser) parseTerm() (exprFunc, error) {
+	lhs, err := p.parseUnary()
+	for err == nil {
+		var rhs exprFunc
+		if p.accept('*') {
+			rhs, err = p.parseUnary()
+			lhs = binary(lhs, rhs, func(x, y *big.Rat) (*big.Rat, error) {
+				return new(big.Rat).Mul(x, y), nil
+			})
+		} else if p.accept('/') {
+			rhs, err = p.parseUnary()
+			lhs = binary(lhs, rhs, func(x, y *big.Rat) (*big.Rat, error) {
+				if y.Sign() == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return new(big.Rat).Quo(x, y), nil
+			})
+		} else {
+			break
+		}
+	}
+	return lhs, err
+}
+
+func (p *exprParser) parseUnary() (exprFunc, error) {
+	if p.accept('+') {
+		return p.parseUnary()
+	} else if p.accept('-') {
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(vals []*big.Rat) (*big.Rat, error) {
+			v, err := f(vals)
+			if err != nil {
+				return nil, err
+			}
+			return new(big.Rat).Neg(v), nil
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprFunc, error) {
+	if p.skipSpace() == len(p.src) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '(':
+		p.pos++
+		f, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		} else if !p.accept(')') {
+			return nil, p.errorf("missing )")
+		}
+		return f, nil
+
+	case c == '$':
+		return p.parseField()
+
+	case isDigit(c) || c == '.':
+		return p.parseNumber()
+
+	case isLetter(c):
+		return p.parseCall()
+	}
+	return nil, p.errorf("unexpected %q", p.src[p.pos:p.pos+1])
+}
+
+func (p *exprParser) parseField() (exprFunc, error) {
+	p.pos++ // skip "$"
+	var c column
+	if strings.HasPrefix(p.src[p.pos:], "{") {
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end < 2 {
+			return nil, p.errorf("invalid field name")
+		}
+		c.name = p.src[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+	} else {
+		start := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			c.index = 10*c.index + int(p.src[p.pos]-'0')
+			p.pos++
+		}
+		if p.pos == start {
+			return nil, p.errorf("invalid field")
+		}
+	}
+	i := slices.Index(p.cols, c)
+	if i < 0 {
+		i = len(p.cols)
+		p.cols = append(p.cols, c)
+	}
+	return func(vals []*big.Rat) (*big.Rat, error) { return vals[i], nil }, nil
+}
+
+func (p *exprParser) parseNumber() (exprFunc, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+		p.pos++
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	v, ok := new(big.Rat).SetString(p.src[start:p.pos])
+	if !ok {
+		p.pos = start
+		return nil, p.errorf("invalid number")
+	}
+	return func([]*big.Rat) (*big.Rat, error) { return v, nil }, nil
+}
+
+func (p *exprParser) parseCall() (exprFunc, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+	fn, ok := exprFuncs[name]
+	if !ok {
+		p.pos = start
+		return nil, p.errorf("unknown function %q", name)
+	} else if !p.accept('(') {
+		return nil, p.errorf("missing ( after %s", name)
+	}
+	var args []exprFunc
+	for {
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(')') {
+			break
+		} else if !p.accept(',') {
+			return nil, p.errorf("missing ) after arguments to %s", name)
+		}
+	}
+	if fn.nargs > 0 && len(args) != fn.nargs {
+		p.pos = start
+		return nil, p.errorf("%s takes %d argument(s), got %d", name, fn.nargs, len(args))
+	}
+	return func(vals []*big.Rat) (*big.Rat, error) {
+		xs := make([]*big.Rat, len(args))
+		for i, arg := range args {
+			v, err := arg(vals)
+			if err != nil {
+				return nil, err
+			}
+			xs[i] = v
+		}
+		return fn.f(xs)
+	}, nil
+}
+
+// exprFuncs are the functions that may be called in an expression. If nargs
+// is 0, the function takes one or more arguments.
+var exprFuncs = map[string]struct {
+	nargs int
+	f     func([]*big.Rat) (*big.Rat, error)
+}{
+	"abs": {1, func(xs []*big.Rat) (*big.Rat, error) { return new(big.Rat).Abs(xs[0]), nil }},
+	"min": {0, func(xs []*big.Rat) (*big.Rat, error) {
+		return slices.MinFunc(xs, (*big.Rat).Cmp), nil
+	}},
+	"max": {0, func(xs []*big.Rat) (*big.Rat, error) {
+		return slices.MaxFunc(xs, (*big.Rat).Cmp), nil
+	}},
+	"log": {1, func(xs []*big.Rat) (*big.Rat, error) {
+		if xs[0].Sign() <= 0 {
+			return nil, fmt.Errorf("log of non-positive value %s", xs[0].RatString())
+		}
+		f, _ := xs[0].Float64()
+		v := ratFloat(math.Log(f))
+		if v == nil {
+			return nil, fmt.Errorf("log of %s is out of range", xs[0].RatString())
+		}
+		return v, nil
+	}},
+}
+
+// binary returns a function that applies op to the results of lhs and rhs.
+// If rhs == nil, it returns nil.
+func binary(lhs, rhs exprFunc, op func(x, y *big.Rat) (*big.Rat, error)) exprFunc {
+	if rhs == nil {
+		return nil
+	}
+	return func(vals []*big.Rat) (*big.Rat, error) {
+		x, err := lhs(vals)
+		if err != nil {
+			return nil, err
+		}
+		y, err := rhs(vals)
+		if err != nil {
+			return nil, err
+		}
+		return op(x, y)
+	}
+}
+
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	split := regexp.MustCompile(` +`)
+	tests := []struct {
+		expr, input string
+		want        string // as a RatString, or "error"
+	}{
+		{"$1", "5", "5"},
+		{"$0", "  7 ", "7"},
+		{"$3 / $2 * 1000", "a 4 3", "750"},
+		{"1 + 2 * 3", "", "7"},
+		{"(1 + 2) * 3", "", "9"},
+		{"10 - 4 - 3", "", "3"},
+		{"12 / 3 / 2", "", "2"},
+		{"-$1 + +2", "3", "-1"},
+		{"--$1", "3", "3"},
+		{"1/3 + 1/6", "", "1/2"},
+		{"1.5e3 + 2E-1 + .5", "", "15007/10"},
+		{"$1 * $1 - $2", "3/2 1", "5/4"},
+		{"abs($1 - $2)", "2 5", "3"},
+		{"min($1, $2, 0)", "2 5", "0"},
+		{"max( $1 , $2 )", "2 5", "5"},
+		{"max($1)", "-2", "-2"},
+		{"log(1)", "", "0"},
+
+		// Evaluation errors.
+		{"$1 / $2", "1 0", "error"},
+		{"$1 / ($2 - 1)", "1 1", "error"},
+		{"$3", "1 2", "error"},
+		{"$1", "x", "error"},
+		{"log($1)", "0", "error"},
+		{"log(-1)", "", "error"},
+	}
+	for _, tc := range tests {
+		e, err := parseExpr(tc.expr)
+		if err != nil {
+			t.Errorf("parseExpr(%q): unexpected error: %v", tc.expr, err)
+			continue
+		}
+		rec := &record{kind: textRecord, text: tc.input, split: split}
+		got, err := e.Eval(rec)
+		if err != nil {
+			if tc.want != "error" {
+				t.Errorf("Eval(%q, %q): unexpected error: %v", tc.expr, tc.input, err)
+			}
+		} else if s := got.RatString(); s != tc.want {
+			t.Errorf("Eval(%q, %q): got %s, want %s", tc.expr, tc.input, s, tc.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"", "1 +", "(1", "1)", "$", "$x", "${}", "2 $1", "foo(1)", "abs", "abs(1, 2)",
+		"min()", "max(1,)", "1..2", "1 % 2",
+	} {
+		if e, err := parseExpr(bad); err == nil {
+			t.Errorf("parseExpr(%q): got %v, want error", bad, e)
+		}
+	}
+}
+
+func TestExprColumns(t *testing.T) {
+	e, err := parseExpr("($3 + ${a.b}) / $3 - $1")
+	if err != nil {
+		t.Fatalf("parseExpr: %v", err)
+	}
+	want := []column{{index: 3}, {name: "a.b"}, {index: 1}}
+	if len(e.cols) != len(want) {
+		t.Fatalf("Columns: got %v, want %v", e.cols, want)
+	}
+	for i, c := range want {
+		if e.cols[i] != c {
+			t.Errorf("Column %d: got %v, want %v", i, e.cols[i], c)
+		}
+	}
+}
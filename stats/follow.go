@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/creachadair/mds/queue"
+)
+
+// A window retains the most recent samples, limited by count or by age.
+// A nil *window retains no samples.
+type window struct {
+	size int           // if positive, the maximum number of samples
+	age  time.Duration // if positive, the maximum age of samples
+	q    queue.Queue[timedSample]
+}
+
+type timedSample struct {
+	when time.Time
+	sample
+}
+
+// parseWindow parses a window specification, either a count of samples or
+// a duration. It returns nil if s is empty.
+func parseWindow(s string) (*window, error) {
+	if s == "" {
+		return nil, nil
+	} else if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 {
+			return nil, fmt.Errorf("window size must be positive")
+		}
+		return &window{size: n}, nil
+	} else if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("window duration must be positive")
+		}
+		return &window{age: d}, nil
+	}
+	return nil, fmt.Errorf("invalid window %q", s)
+}
+
+// Add adds s to the window, received at time now.
+func (w *window) Add(now time.Time, s sample) {
+	w.q.Add(timedSample{when: now, sample: s})
+	if w.size > 0 && w.q.Len() > w.size {
+		w.q.Pop()
+	}
+}
+
+// Fill discards samples older than the window as of time now, and adds the
+// remaining samples to gs.
+func (w *window) Fill(now time.Time, gs *groupSet) {
+	if w.age > 0 {
+		for !w.q.IsEmpty() && now.Sub(w.q.Front().when) > w.age {
+			w.q.Pop()
+		}
+	}
+	w.q.Each(func(ts timedSample) bool {
+		gs.AddSample(ts.sample)
+		return true
+	})
+}
+
+// runStream reads samples from the input files in order of arrival, and
+// writes a report at the end of the input. If -follow is set, it reads until
+// ctx ends, and writes a report every -every interval. If win != nil, each
+// report covers only the samples in the window.
+func runStream(ctx context.Context, ir *inputReader, rep *reporter, w io.Writer, paths []string, win *window) {
+	samples := make(chan sample)
+	done := make(chan struct{})
+	nread := len(paths)
+	for _, path := range paths {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			var r io.ReadCloser
+			name := path
+			if *doFollow && path != "-" {
+				r = newTailReader(ctx, path)
+			} else {
+				var err error
+				r, name, err = openInput(path)
+				if err != nil {
+					ir.fail(err)
+					return
+				}
+			}
+			defer r.Close()
+			ir.scan(name, r, func(s sample) {
+				select {
+				case samples <- s:
+				case <-ctx.Done():
+				}
+			})
+		}()
+	}
+
+	var tick <-chan time.Time
+	if *doFollow {
+		t := time.NewTicker(*interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	gs := ir.newSet()
+	report := func() {
+		ir.flush()
+		cur := gs
+		if win != nil {
+			cur = ir.newSet()
+			win.Fill(time.Now(), cur)
+		}
+		if err := rep.write(w, cur); err != nil {
+			exitReport(err)
+		}
+	}
+	for nread > 0 {
+		select {
+		case s := <-samples:
+			if win != nil {
+				win.Add(time.Now(), s)
+			} else {
+				gs.AddSample(s)
+			}
+			ir.echo(s)
+		case <-done:
+			nread--
+		case <-tick:
+			report()
+		case <-ctx.Done():
+			report()
+			return
+		}
+	}
+	report()
+}
+
+// tailPollInterval is how often a tailReader checks for new data at the end
+// of its input. It is a variable so that tests can shorten it.
+var tailPollInterval = 250 * time.Millisecond
+
+// A tailReader reads a file continuously as it grows, like tail -F.
+// When it reaches the end of the file, it waits for more data, reopening the
+// file if it has been replaced, and starting over if it has been truncated.
+// It reports io.EOF only when its context ends.
+type tailReader struct {
+	ctx  context.Context
+	path string
+	f    *os.File // nil if the file is not (yet) open
+	off  int64    // current offset in f
+	last []byte   // the last bytes read from f, ending at off
+}
+
+// tailCheckLen is the number of bytes a tailReader keeps from the end of what
+// it has read, to check whether the file has been rewritten.
+const tailCheckLen = 64
+
+func newTailReader(ctx context.Context, path string) *tailReader {
+	return &tailReader{ctx: ctx, path: path}
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		if t.f != nil {
+			n, err := t.f.Read(p)
+			t.off += int64(n)
+			if n > 0 {
+				t.keep(p[:n])
+				return n, nil
+			} else if err != nil && err != io.EOF {
+				return 0, err
+			}
+		}
+
+		// We are at the end of the file, or it is not open. Check whether the
+		// file has been replaced or truncated before waiting for more.
+		if fi, err := os.Stat(t.path); err == nil {
+			if t.f == nil {
+				t.reopen()
+				continue
+			} else if cur, err := t.f.Stat(); err == nil && !os.SameFile(fi, cur) {
+				t.reopen()
+				continue
+			} else if fi.Size() < t.off {
+				if err := t.restart(); err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(tailPollInterval):
+		}
+
+		// The file may have been truncated and rewritten while we waited, to
+		// its old size or beyond, so that its size alone does not show it.
+		// Check that what we read last is still there before reading on.
+		if t.f != nil && t.rewritten() {
+			if err := t.restart(); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// keep records the end of data, which was just read from t.f, in t.last.
+func (t *tailReader) keep(data []byte) {
+	t.last = append(t.last, data[max(0, len(data)-tailCheckLen):]...)
+	if k := len(t.last) - tailCheckLen; k > 0 {
+		t.last = append(t.last[:0], t.last[k:]...)
+	}
+}
+
+// rewritten reports whether the bytes of t.f before the current offset differ
+// from those last read.
+func (t *tailReader) rewritten() bool {
+	buf := make([]byte, len(t.last))
+	n, _ := t.f.ReadAt(buf, t.off-int64(len(buf)))
+	return !bytes.Equal(buf[:n], t.last)
+}
+
+// restart starts reading the current file over from the beginning, after it
+// has been truncated.
+func (t *tailReader) restart() error {
+	log.Printf("In %s: file truncated", t.path)
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	t.off, t.last = 0, nil
+	return nil
+}
+
+// reopen opens the current file at t.path, replacing the old file if any.
+// If the open fails, t is left with no open file.
+func (t *tailReader) reopen() {
+	if t.f != nil {
+		log.Printf("In %s: file replaced; reopening", t.path)
+		t.f.Close()
+	}
+	t.f, t.off, t.last = nil, 0, nil
+	if f, err := os.Open(t.path); err == nil {
+		t.f = f
+	}
+}
+
+// Close closes the file being read, if any.
+func (t *tailReader) Close() error {
+	if t.f != nil {
+		return t.f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	for _, bad := range []string{"0", "-5", "0s", "bogus"} {
+		if w, err := parseWindow(bad); err == nil {
+			t.Errorf("parseWindow(%q): got %+v, want error", bad, w)
+		}
+	}
+
+	countOf := func(w *window, now time.Time) int64 {
+		gs := newGroupSet(1, collectOptions{})
+		w.Fill(now, gs)
+		var n int64
+		for _, g := range gs.groups {
+			n += g.cs[0].Count()
+		}
+		return n
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	addN := func(w *window, n int) {
+		for i := range n {
+			w.Add(start.Add(time.Duration(i)*time.Second), sample{vs: []value{floatValue(float64(i))}})
+		}
+	}
+
+	t.Run("Count", func(t *testing.T) {
+		w, err := parseWindow("5")
+		if err != nil {
+			t.Fatalf("parseWindow: %v", err)
+		}
+		addN(w, 12)
+		if got := countOf(w, start); got != 5 {
+			t.Errorf("Window count: got %d, want 5", got)
+		}
+	})
+
+	t.Run("Age", func(t *testing.T) {
+		w, err := parseWindow("3s")
+		if err != nil {
+			t.Fatalf("parseWindow: %v", err)
+		}
+		addN(w, 10) // at 0s, 1s, ..., 9s
+		if got := countOf(w, start.Add(9*time.Second)); got != 4 {
+			t.Errorf("Window count at 9s: got %d, want 4", got)
+		}
+		if got := countOf(w, start.Add(20*time.Second)); got != 0 {
+			t.Errorf("Window count at 20s: got %d, want 0", got)
+		}
+	})
+}
+
+func TestTailReader(t *testing.T) {
+	defer func(d time.Duration) { tailPollInterval = d }(tailPollInterval)
+	tailPollInterval = 5 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "log")
+	write := func(path string, flag int, text string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	tr := newTailReader(ctx, path)
+	defer tr.Close()
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(tr)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got, ok := <-lines:
+				if !ok {
+					t.Fatalf("Reader ended, want %q", w)
+				} else if got != w {
+					t.Fatalf("Got line %q, want %q", got, w)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out waiting for %q", w)
+			}
+		}
+	}
+
+	// The reader waits for the file to exist, and follows it as it grows.
+	time.Sleep(2 * tailPollInterval)
+	write(path, 0, "1\n2\n")
+	expect("1", "2")
+	write(path, os.O_APPEND, "3\n")
+	expect("3")
+
+	// After truncation, the reader starts over from the beginning.
+	write(path, os.O_TRUNC, "4\n")
+	expect("4")
+
+	// Likewise if the file is rewritten to at least its old size, so that
+	// it is not seen to shrink.
+	write(path, os.O_TRUNC, "4a\n4b\n")
+	expect("4a", "4b")
+
+	// After rotation, the reader finishes the old file, then reads the new
+	// one from the beginning.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	write(path+".1", os.O_APPEND, "5\n")
+	expect("5")
+	write(path, 0, "6\n7\n")
+	expect("6", "7")
+
+	// The reader reports the end of input only when its context ends, even
+	// if the file is idle.
+	time.Sleep(4 * tailPollInterval)
+	select {
+	case got := <-lines:
+		t.Fatalf("Idle reader: got %q, want no lines", got)
+	default:
+	}
+	cancel()
+	select {
+	case got, ok := <-lines:
+		if ok {
+			t.Errorf("After cancel: got %q, want end of input", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Reader did not end after its context ended")
+	}
+}
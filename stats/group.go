@@ -0,0 +1,168 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A group is the set of collectors for the lines sharing a key, with one
+// collector for each selected field. With the xy option, the group instead
+// has a single collector for the pair of selected fields.
+type group struct {
+	key []string
+	cs  []*collector
+	xy  *pairCollector
+}
+
+// A groupSet partitions values into groups by key.
+type groupSet struct {
+	nfields int
+	opts    collectOptions
+	groups  map[string]*group
+}
+
+func newGroupSet(nfields int, opts collectOptions) *groupSet {
+	return &groupSet{nfields: nfields, opts: opts, groups: make(map[string]*group)}
+}
+
+// Add adds the values vs to the group for key.
+func (g *groupSet) Add(key []string, vs []value) {
+	if grp := g.group(key); grp.xy != nil {
+		if len(vs) == 2 {
+			grp.xy.Add(vs[0].Float(), vs[1].Float())
+		}
+	} else {
+		for i, v := range vs {
+			grp.cs[i].Add(v)
+		}
+	}
+}
+
+// AddWeighted adds the values vs to the group for key, each with weight w.
+// The group is created even if w is zero.
+func (g *groupSet) AddWeighted(key []string, vs []value, w value) {
+	grp := g.group(key)
+	for i, v := range vs {
+		grp.cs[i].AddWeighted(v, w)
+	}
+}
+
+// AddText adds an occurrence of the text value s to the group for key. The
+// set must have been created with the count option.
+func (g *groupSet) AddText(key []string, s string) {
+	g.group(key).cs[0].AddText(s)
+}
+
+// AddSample adds the values of s to the group for its key, with its weight
+// if it has one, or its text if the set was created with the count option.
+// Values marked invalid in s are skipped.
+func (g *groupSet) AddSample(s sample) {
+	if g.opts.count {
+		g.AddText(s.key, s.str)
+	} else if s.bad != nil {
+		grp := g.group(s.key)
+		for i, v := range s.vs {
+			if s.bad[i] {
+				continue
+			} else if s.w != nil {
+				grp.cs[i].AddWeighted(v, *s.w)
+			} else {
+				grp.cs[i].Add(v)
+			}
+		}
+	} else if s.w != nil {
+		g.AddWeighted(s.key, s.vs, *s.w)
+	} else {
+		g.Add(s.key, s.vs)
+	}
+}
+
+// group returns the group for key, creating it if necessary.
+func (g *groupSet) group(key []string) *group {
+	id := strings.Join(key, "\x00")
+	grp, ok := g.groups[id]
+	if !ok {
+		grp = &group{key: key}
+		if g.opts.xy {
+			grp.xy = new(pairCollector)
+		} else {
+			grp.cs = make([]*collector, g.nfields)
+			for i := range grp.cs {
+				grp.cs[i] = newCollector(g.opts)
+			}
+		}
+		g.groups[id] = grp
+	}
+	return grp
+}
+
+// Merge adds the groups from o to g. Both must have been created with the
+// same options.
+func (g *groupSet) Merge(o *groupSet) {
+	for id, og := range o.groups {
+		grp, ok := g.groups[id]
+		if !ok {
+			g.groups[id] = og
+			continue
+		}
+		if grp.xy != nil {
+			grp.xy.Merge(og.xy)
+		}
+		for i, c := range grp.cs {
+			c.Merge(og.cs[i])
+		}
+	}
+}
+
+// A groupReport is the reported statistics for a group.
+type groupReport struct {
+	*group
+	results [][]result // one per field
+}
+
+// Report returns reports for all the groups in g, with values formatted
+// according to the units for each field. If by == "key", the groups
+// are ordered by key; otherwise by is the name of a reported statistic, and
+// groups are ordered by decreasing value of that statistic for the first
+// selected field. If top > 0, at most top groups are returned. With the xy
+// option, each group has a single report for the pair of selected fields.
+func (g *groupSet) Report(pcts []percentile, units []unitKind, by string, top int) ([]groupReport, error) {
+	out := make([]groupReport, 0, len(g.groups))
+	for _, grp := range g.groups {
+		rs := make([][]result, len(grp.cs))
+		for i, c := range grp.cs {
+			rs[i] = c.Report(pcts, units[i])
+		}
+		if grp.xy != nil {
+			rs = [][]result{grp.xy.Report()}
+		}
+		out = append(out, groupReport{group: grp, results: rs})
+	}
+
+	if by == "key" {
+		slices.SortFunc(out, func(a, b groupReport) int { return slices.Compare(a.key, b.key) })
+	} else if len(out) != 0 {
+		pos := slices.IndexFunc(out[0].results[0], func(r result) bool { return r.key == by })
+		if pos < 0 {
+			return nil, fmt.Errorf("sort key %q is not a reported statistic", by)
+		}
+		slices.SortStableFunc(out, func(a, b groupReport) int {
+			va, vb := a.results[0][pos].num, b.results[0][pos].num
+			switch {
+			case va == nil && vb == nil:
+				return slices.Compare(a.key, b.key)
+			case va == nil:
+				return 1
+			case vb == nil:
+				return -1
+			}
+			return cmp.Or(vb.Cmp(va), slices.Compare(a.key, b.key))
+		})
+	}
+	if top > 0 && len(out) > top {
+		out = out[:top]
+	}
+	return out, nil
+}
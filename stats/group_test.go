@@ -0,0 +1,51 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGroupReport(t *testing.T) {
+	defer func(old bool) { *doMean = old }(*doMean)
+	*doMean = true
+
+	gs := newGroupSet(1, collectOptions{})
+	for _, in := range []struct {
+		key string
+		v   int64
+	}{
+		{"a", 10}, {"b", 20}, {"a", 30}, {"c", 5}, {"b", 40}, {"a", 20},
+	} {
+		gs.Add([]string{in.key}, []value{floatValue(float64(in.v))})
+	}
+
+	keysOf := func(rs []groupReport) []string {
+		var out []string
+		for _, r := range rs {
+			out = append(out, r.key[0])
+		}
+		return out
+	}
+	tests := []struct {
+		by   string
+		top  int
+		want []string
+	}{
+		{"key", 0, []string{"a", "b", "c"}},
+		{"n", 0, []string{"a", "b", "c"}},
+		{"avg", 0, []string{"b", "a", "c"}},
+		{"avg", 2, []string{"b", "a"}},
+	}
+	for _, tc := range tests {
+		rs, err := gs.Report(nil, []unitKind{noUnit}, tc.by, tc.top)
+		if err != nil {
+			t.Errorf("Report(%q, %d): unexpected error: %v", tc.by, tc.top, err)
+		} else if got := keysOf(rs); !slices.Equal(got, tc.want) {
+			t.Errorf("Report(%q, %d): got %q, want %q", tc.by, tc.top, got, tc.want)
+		}
+	}
+
+	if rs, err := gs.Report(nil, []unitKind{noUnit}, "max", 0); err == nil {
+		t.Errorf("Report(max): got %d groups, want error", len(rs))
+	}
+}
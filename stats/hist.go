@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A histogram retains values to be partitioned into buckets.
+type histogram struct {
+	vs []value
+	ws []float64 // weights of vs, or nil if all are 1
+}
+
+// Add adds v to the histogram.
+func (h *histogram) Add(v value) {
+	h.vs = append(h.vs, v)
+	if h.ws != nil {
+		h.ws = append(h.ws, 1)
+	}
+}
+
+// AddWeighted adds v to the histogram with weight w.
+func (h *histogram) AddWeighted(v value, w float64) {
+	if h.ws == nil && w == 1 {
+		h.Add(v)
+		return
+	}
+	h.weigh()
+	h.vs = append(h.vs, v)
+	h.ws = append(h.ws, w)
+}
+
+// weigh populates h.ws with unit weights if it is nil.
+func (h *histogram) weigh() {
+	if h.ws == nil {
+		h.ws = make([]float64, len(h.vs), cap(h.vs))
+		for i := range h.ws {
+			h.ws[i] = 1
+		}
+	}
+}
+
+// Merge adds the values from o to h.
+func (h *histogram) Merge(o *histogram) {
+	if o.ws != nil {
+		h.weigh()
+		h.ws = append(h.ws, o.ws...)
+	} else if h.ws != nil {
+		for range o.vs {
+			h.ws = append(h.ws, 1)
+		}
+	}
+	h.vs = append(h.vs, o.vs...)
+}
+
+// A bucket is a half-open interval [lo, hi), the number of values in it, and
+// their total weight, which is the same as the count for unweighted values.
+// A nil lo or hi means the bucket is unbounded on that side.
+type bucket struct {
+	lo, hi *big.Rat
+	count  int64
+	weight float64
+}
+
+// Buckets partitions the values in h into buckets delimited by edges, which
+// must be in increasing order. The last bucket includes its upper edge.
+// Values outside the range of edges are counted in unbounded buckets at the
+// ends, which are omitted if empty.
+func (h *histogram) Buckets(edges []*big.Rat) []bucket {
+	if len(edges) < 2 {
+		return nil
+	}
+	bs := make([]bucket, len(edges)+1)
+	bs[0].hi = edges[0]
+	for i := 1; i < len(edges); i++ {
+		bs[i].lo, bs[i].hi = edges[i-1], edges[i]
+	}
+	bs[len(edges)].lo = edges[len(edges)-1]
+
+	// Compare values with edges of the same kind, so that float64 values do
+	// not each have to be converted.
+	es := make([]value, len(edges))
+	for i, e := range edges {
+		es[i] = ratValue(e)
+		if len(h.vs) != 0 && h.vs[0].r == nil {
+			es[i] = floatValue(es[i].Float())
+		}
+	}
+
+	last := len(edges) - 1
+	for j, v := range h.vs {
+		// Find the first edge greater than v; v belongs to the bucket below it.
+		i := sort.Search(len(es), func(i int) bool { return es[i].Cmp(v) > 0 })
+		if i == len(es) && v.Cmp(es[last]) == 0 {
+			i = last // the top edge is inclusive
+		}
+		bs[i].count++
+		if h.ws != nil {
+			bs[i].weight += h.ws[j]
+		} else {
+			bs[i].weight++
+		}
+	}
+
+	if bs[len(edges)].count == 0 {
+		bs = bs[:len(edges)]
+	}
+	if bs[0].count == 0 {
+		bs = bs[1:]
+	}
+	return bs
+}
+
+// linearEdges returns n+1 evenly-spaced edges spanning lo to hi.
+// If lo == hi, there is only one bucket.
+func linearEdges(lo, hi *big.Rat, n int) []*big.Rat {
+	if lo.Cmp(hi) == 0 {
+		return []*big.Rat{lo, hi}
+	}
+	width := new(big.Rat).Sub(hi, lo)
+	width.Quo(width, big.NewRat(int64(n), 1))
+	out := []*big.Rat{lo}
+	for i := 1; i < n; i++ {
+		e := new(big.Rat).Mul(width, big.NewRat(int64(i), 1))
+		out = append(out, e.Add(e, lo))
+	}
+	return append(out, hi)
+}
+
+// logEdges returns n+1 logarithmically-spaced edges spanning lo to hi.
+// Both lo and hi must be positive. If lo == hi, there is only one bucket.
+func logEdges(lo, hi *big.Rat, n int) ([]*big.Rat, error) {
+	if lo.Sign() <= 0 {
+		return nil, fmt.Errorf("log scale requires positive values (min is %s)", ratString(lo))
+	} else if lo.Cmp(hi) == 0 {
+		return []*big.Rat{lo, hi}, nil
+	}
+	flo, _ := lo.Float64()
+	fhi, _ := hi.Float64()
+	step := (math.Log(fhi) - math.Log(flo)) / float64(n)
+	out := []*big.Rat{lo}
+	for i := 1; i < n; i++ {
+		out = append(out, new(big.Rat).SetFloat64(flo*math.Exp(step*float64(i))))
+	}
+	return append(out, hi), nil
+}
+
+// parseEdges parses a comma-separated list of increasing bucket edges.
+func parseEdges(s string) ([]*big.Rat, error) {
+	var out []*big.Rat
+	for e := range strings.SplitSeq(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		v, ok := new(big.Rat).SetString(e)
+		if !ok {
+			return nil, fmt.Errorf("invalid edge %q", e)
+		} else if len(out) != 0 && v.Cmp(out[len(out)-1]) <= 0 {
+			return nil, fmt.Errorf("edge %q is not increasing", e)
+		}
+		out = append(out, v)
+	}
+	if len(out) < 2 {
+		return nil, fmt.Errorf("at least 2 edges are required")
+	}
+	return out, nil
+}
+
+// writeHistogram renders bs to w as a table of bucket ranges, weights, and
+// percentages, with a bar for each bucket scaled to fit within width columns.
+// Bucket edges are formatted using format. For unweighted values, the weight
+// of each bucket is its count.
+func writeHistogram(w io.Writer, bs []bucket, width int, format func(*big.Rat) string) error {
+	var total, most float64
+	labels := make([][3]string, len(bs))
+	var wlo, whi, wcount int
+	for i, b := range bs {
+		total += b.weight
+		most = max(most, b.weight)
+		labels[i] = [3]string{
+			edgeString(b.lo, "-∞", format), edgeString(b.hi, "+∞", format),
+			ratString(new(big.Rat).SetFloat64(b.weight)),
+		}
+		wlo = max(wlo, utf8.RuneCountInString(labels[i][0]))
+		whi = max(whi, utf8.RuneCountInString(labels[i][1]))
+		wcount = max(wcount, len(labels[i][2]))
+	}
+
+	// Layout: "[lo, hi)  count  pct%  cum% bar"
+	prefix := 1 + wlo + 2 + whi + 1 + 2 + wcount + 2 + 6 + 2 + 6 + 1
+	barMax := max(width-prefix, 10)
+
+	var cum float64
+	for i, b := range bs {
+		cum += b.weight
+		opener, closer := "[", ")"
+		if b.lo == nil || b.hi == nil {
+			opener = "(" // unbounded, or the top edge belongs to the bucket below
+		}
+		if b.hi != nil && (i == len(bs)-1 || bs[i+1].hi == nil) {
+			closer = "]" // the top edge is inclusive
+		}
+		var pct, cpct float64
+		if total > 0 {
+			pct = 100 * b.weight / total
+			cpct = 100 * cum / total
+		}
+		var bar int
+		if most > 0 {
+			bar = int(b.weight * float64(barMax) / most)
+		}
+		if _, err := fmt.Fprintf(w, "%s%*s, %*s%s  %*s  %5.1f%%  %5.1f%% %s\n",
+			opener, wlo, labels[i][0], whi, labels[i][1], closer, wcount, labels[i][2],
+			pct, cpct, strings.Repeat("#", bar)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func edgeString(r *big.Rat, inf string, format func(*big.Rat) string) string {
+	if r == nil {
+		return inf
+	}
+	return format(r)
+}
+
+// terminalWidth reports the width of the output terminal in columns, using
+// the COLUMNS environment variable if it is set, or else the size of the
+// terminal on stdout, or a default if stdout is not a terminal.
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	} else if n := ttyWidth(); n > 0 {
+		return n
+	}
+	return 80
+}
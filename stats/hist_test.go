@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	h := new(histogram)
+	for i := int64(0); i <= 10; i++ {
+		h.Add(ratValue(big.NewRat(i, 1)))
+	}
+
+	t.Run("Linear", func(t *testing.T) {
+		bs := h.Buckets(linearEdges(big.NewRat(0, 1), big.NewRat(10, 1), 4))
+		want := []int64{3, 2, 3, 3} // [0, 2.5) [2.5, 5) [5, 7.5) [7.5, 10]
+		checkCounts(t, bs, want)
+	})
+
+	t.Run("Explicit", func(t *testing.T) {
+		edges, err := parseEdges("2,5,8")
+		if err != nil {
+			t.Fatalf("Parse edges: %v", err)
+		}
+		bs := h.Buckets(edges)
+		want := []int64{2, 3, 4, 2} // (-∞, 2) [2, 5) [5, 8] (8, +∞)
+		checkCounts(t, bs, want)
+		if bs[0].lo != nil || bs[len(bs)-1].hi != nil {
+			t.Errorf("Outer buckets should be unbounded: %+v", bs)
+		}
+
+		// The top edge belongs to the last bounded bucket, not the unbounded
+		// bucket above it.
+		var buf bytes.Buffer
+		if err := writeHistogram(&buf, bs, 40, ratString); err != nil {
+			t.Fatalf("writeHistogram: %v", err)
+		}
+		const want2 = `(-∞,  2)  2   18.2%   18.2% ######
+[ 2,  5)  3   27.3%   45.5% #########
+[ 5,  8]  4   36.4%   81.8% ############
+( 8, +∞)  2   18.2%  100.0% ######
+`
+		if diff := cmp.Diff(want2, buf.String()); diff != "" {
+			t.Errorf("Histogram (-want, +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Log", func(t *testing.T) {
+		if _, err := logEdges(big.NewRat(0, 1), big.NewRat(10, 1), 3); err == nil {
+			t.Error("logEdges with zero minimum: got nil, want error")
+		}
+		edges, err := logEdges(big.NewRat(1, 1), big.NewRat(1000, 1), 3)
+		if err != nil {
+			t.Fatalf("logEdges: %v", err)
+		}
+		for i, want := range []float64{1, 10, 100, 1000} {
+			if got, _ := edges[i].Float64(); got < want*0.999 || got > want*1.001 {
+				t.Errorf("Edge %d: got %v, want %v", i, got, want)
+			}
+		}
+	})
+}
+
+func TestHistogramWeights(t *testing.T) {
+	h := new(histogram)
+	h.Add(floatValue(1))
+	h.AddWeighted(floatValue(1.5), 2.5)
+	h.AddWeighted(floatValue(3), 0.5)
+	o := new(histogram)
+	o.Add(floatValue(4))
+	h.Merge(o)
+
+	bs := h.Buckets(linearEdges(big.NewRat(0, 1), big.NewRat(4, 1), 2))
+	checkCounts(t, bs, []int64{2, 2})
+	if bs[0].weight != 3.5 || bs[1].weight != 1.5 {
+		t.Errorf("Bucket weights: got %v, %v; want 3.5, 1.5", bs[0].weight, bs[1].weight)
+	}
+
+	setFlags(t, "prec", "1")
+	var buf bytes.Buffer
+	if err := writeHistogram(&buf, bs, 40, ratString); err != nil {
+		t.Fatalf("writeHistogram: %v", err)
+	}
+	const want = `[0, 2)  3.5   70.0%   70.0% ############
+[2, 4]  1.5   30.0%  100.0% #####
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Histogram (-want, +got):\n%s", diff)
+	}
+}
+
+func checkCounts(t *testing.T, bs []bucket, want []int64) {
+	t.Helper()
+	if len(bs) != len(want) {
+		t.Fatalf("Got %d buckets, want %d", len(bs), len(want))
+	}
+	for i, b := range bs {
+		if b.count != want[i] {
+			t.Errorf("Bucket %d [%v, %v): count %d, want %d", i, b.lo, b.hi, b.count, want[i])
+		}
+	}
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A record is a single unit of input, such as a line of text, a CSV record, or
+// a JSON object.
+type record struct {
+	kind recordKind
+	line int    // 1-based line number where the record begins
+	text string // the raw text of the record, including line ending
+	head string // raw text preceding the record that is not a record itself
+
+	split  *regexp.Regexp // text: how to split the line into fields
+	fields []string       // text and CSV: the fields of the record
+	header map[string]int // CSV: map from column name to field index
+	obj    any            // JSON: the decoded value
+}
+
+type recordKind int
+
+const (
+	textRecord recordKind = iota
+	csvRecord
+	jsonRecord
+)
+
+// Get returns the text of the specified column of r.
+func (r *record) Get(c column) (string, error) {
+	switch r.kind {
+	case csvRecord:
+		return r.getCSV(c)
+	case jsonRecord:
+		return r.getJSON(c)
+	default:
+		return r.getText(c)
+	}
+}
+
+func (r *record) getText(c column) (string, error) {
+	if r.split == nil || c.index == 0 {
+		if c.name != "" {
+			return "", fmt.Errorf("named field %q requires -format", c.name)
+		}
+		return strings.TrimSpace(trim(r.text)), nil
+	}
+	if r.fields == nil {
+		r.fields = r.split.Split(trim(r.text), -1)
+	}
+	return fieldAt(r.fields, c.index)
+}
+
+func (r *record) getCSV(c column) (string, error) {
+	idx := c.index
+	if c.name != "" {
+		i, ok := r.header[c.name]
+		if !ok {
+			return "", fmt.Errorf("no column named %q", c.name)
+		}
+		idx = i + 1
+	} else if idx == 0 {
+		return "", errors.New("field 0 is not supported for CSV input")
+	}
+	s, err := fieldAt(r.fields, idx)
+	return strings.TrimSpace(s), err
+}
+
+func (r *record) getJSON(c column) (string, error) {
+	if c.name == "" {
+		return "", fmt.Errorf("field %d: JSON input requires a named field", c.index)
+	}
+	v := r.obj
+	for _, elt := range strings.Split(strings.TrimPrefix(c.name, "."), ".") {
+		switch t := v.(type) {
+		case map[string]any:
+			next, ok := t[elt]
+			if !ok {
+				return "", fmt.Errorf("field %q not found", c.name)
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(elt)
+			if err != nil || i < 0 || i >= len(t) {
+				return "", fmt.Errorf("field %q: invalid array index %q", c.name, elt)
+			}
+			v = t[i]
+		default:
+			return "", fmt.Errorf("field %q not found", c.name)
+		}
+	}
+	switch t := v.(type) {
+	case json.Number:
+		return t.String(), nil
+	case string:
+		return t, nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case nil:
+		return "", fmt.Errorf("field %q is null", c.name)
+	default:
+		return "", fmt.Errorf("field %q is not a scalar value", c.name)
+	}
+}
+
+func fieldAt(fields []string, i int) (string, error) {
+	if len(fields) < i {
+		return "", fmt.Errorf("field %d out of range (%d found)", i, len(fields))
+	}
+	return fields[i-1], nil
+}
+
+// A recordReader reads records from an input.
+type recordReader interface {
+	// Next returns the next record from the input. At the end of the input it
+	// returns io.EOF. If the next record is malformed, it reports a
+	// *badRecordError, and the caller may continue reading.
+	Next() (*record, error)
+}
+
+// badRecordError reports a malformed input record.
+type badRecordError struct {
+	line int
+	text string // the raw text of the record, if available
+	err  error
+}
+
+func (b *badRecordError) Error() string { return b.err.Error() }
+
+// newRecordReader returns a reader for records in the specified format.
+func newRecordReader(format string, r io.Reader, split *regexp.Regexp) (recordReader, error) {
+	switch format {
+	case "", "text":
+		return &textReader{br: bufio.NewReader(r), split: split}, nil
+	case "csv", "tsv":
+		c := &csvReader{header: *useHeader}
+		if *doCat || *rejectFile != "" {
+			c.raw = new(bytes.Buffer)
+			r = io.TeeReader(r, c.raw)
+		}
+		c.cr = csv.NewReader(r)
+		if format == "tsv" {
+			c.cr.Comma = '\t'
+		}
+		c.cr.FieldsPerRecord = -1
+		return c, nil
+	case "jsonl":
+		return &jsonReader{textReader{br: bufio.NewReader(r)}}, nil
+	case "bench":
+		return &benchReader{textReader: textReader{br: bufio.NewReader(r)}}, nil
+	default:
+		return nil, fmt.Errorf("unknown input format %q", format)
+	}
+}
+
+// textReader reads lines of text.
+type textReader struct {
+	br    *bufio.Reader
+	split *regexp.Regexp
+	ln    int
+}
+
+func (t *textReader) Next() (*record, error) {
+	line, err := t.br.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil, io.EOF
+	} else if err != nil && err != io.EOF {
+		return nil, err
+	}
+	t.ln++
+	return &record{kind: textRecord, line: t.ln, text: line, split: t.split}, nil
+}
+
+// csvReader reads CSV records, optionally with a header.
+type csvReader struct {
+	cr     *csv.Reader
+	header bool // treat the first record as a header
+	names  map[string]int
+
+	// If raw is non-nil, it holds the input read by cr that has not yet been
+	// consumed by a record, so that the text of each record can be populated
+	// for -cat and -rejects exactly as it appears in the input.
+	raw  *bytes.Buffer
+	off  int64  // the input offset of the start of raw
+	head string // the text of the header, until it is attached to a record
+}
+
+func (c *csvReader) Next() (*record, error) {
+	for {
+		fields, err := c.cr.Read()
+		text := c.consume()
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return nil, &badRecordError{line: perr.StartLine, err: perr.Err}
+			}
+			return nil, err
+		}
+		line, _ := c.cr.FieldPos(0)
+		if c.header && c.names == nil {
+			c.names = make(map[string]int)
+			for i, name := range fields {
+				if _, ok := c.names[name]; !ok {
+					c.names[name] = i
+				}
+			}
+			c.head = text
+			continue
+		}
+		rec := &record{kind: csvRecord, line: line, text: text, head: c.head, fields: fields, header: c.names}
+		c.head = ""
+		return rec, nil
+	}
+}
+
+// consume returns the raw text of the input read since the previous call, up
+// to the end of the last record read by c.cr, or "" if the text is not kept.
+func (c *csvReader) consume() string {
+	if c.raw == nil {
+		return ""
+	}
+	end := c.cr.InputOffset()
+	text := string(c.raw.Next(int(end - c.off)))
+	c.off = end
+	return text
+}
+
+// jsonReader reads JSON Lines, one JSON value per line.
+type jsonReader struct{ textReader }
+
+func (j *jsonReader) Next() (*record, error) {
+	for {
+		rec, err := j.textReader.Next()
+		if err != nil {
+			return nil, err
+		} else if strings.TrimSpace(rec.text) == "" {
+			continue // skip blank lines
+		}
+		dec := json.NewDecoder(strings.NewReader(rec.text))
+		dec.UseNumber()
+		if err := dec.Decode(&rec.obj); err != nil {
+			return nil, &badRecordError{line: rec.line, text: rec.text, err: fmt.Errorf("invalid JSON: %w", err)}
+		}
+		rec.kind = jsonRecord
+		return rec, nil
+	}
+}
+
+// A sample is the data selected from a single input record.
+type sample struct {
+	key  []string // grouping key, if any
+	vs   []value  // values of selected fields
+	bad  []bool   // bad[i] reports whether vs[i] is invalid; nil if none is
+	w    *value   // weight of the values, if weighted
+	str  string   // the selected text, with -count
+	text string   // the original text of the record
+	head string   // the original text preceding the record, such as a header
+	src  string   // the name of the input
+	line int      // the line number of the record in the input
+}
+
+// An inputReader reads input files and gathers statistics from them.
+type inputReader struct {
+	format    string
+	split     *regexp.Regexp
+	pick      *picker
+	opts      collectOptions
+	cat       *bufio.Writer // if non-nil, echo valid input records here
+	rejects   *bufio.Writer // if non-nil, write rejected records here
+	strict    bool          // exit on the first rejected record
+	maxErrors int           // if positive, exit after more rejected records
+
+	mu      sync.Mutex
+	nbad    int            // total number of rejected records
+	skipped map[string]int // number of rejected records per input
+	failed  bool           // some input could not be read
+}
+
+// newSet returns a new empty set of groups for the selected fields. If there
+// are no grouping keys, the set contains the ungrouped totals, so that a
+// report is produced even if there is no input.
+func (ir *inputReader) newSet() *groupSet {
+	gs := newGroupSet(len(ir.pick.fields), ir.opts)
+	if len(ir.pick.keys) == 0 && ir.pick.time == nil {
+		gs.Add(nil, nil)
+	}
+	return gs
+}
+
+// openInput opens the input file at path. The special path "-" denotes
+// standard input. It returns the name to use for the file in diagnostics.
+// Compressed input is decompressed transparently (see decompress).
+func openInput(path string) (io.ReadCloser, string, error) {
+	f, name := os.Stdin, "<stdin>"
+	if path != "-" {
+		var err error
+		f, err = os.Open(path)
+		if err != nil {
+			return nil, path, err
+		}
+		name = path
+	}
+	r, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, name, fmt.Errorf("In %s: %w", name, err)
+	}
+	return readCloser{Reader: r, Closer: f}, name, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// decompress returns a reader for the decompressed contents of r, if r
+// begins with the header of a gzip, bzip2, or zlib stream, or otherwise for
+// the contents of r unchanged. Compression is detected by the contents, not
+// the name, of the input, so that it works for standard input.
+func decompress(r io.Reader) (io.Reader, error) {
+	// Peek only as far as needed to detect each format, so that reading from
+	// a pipe does not wait for input beyond the first line.
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(2)
+	if string(head) == "BZ" {
+		head, _ = br.Peek(10)
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		return gzip.NewReader(br)
+
+	case isBzip2(head):
+		return bzip2.NewReader(br), nil
+
+	case isZlib(head):
+		// A zlib header is only two bytes, and some of them are plausible
+		// text, so make sure the start of the stream actually decodes.
+		buf, _ := br.Peek(br.Buffered())
+		if zr, err := zlib.NewReader(bytes.NewReader(buf)); err == nil {
+			_, err = io.Copy(io.Discard, zr)
+			if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+				return zlib.NewReader(br)
+			}
+		}
+	}
+	return br, nil
+}
+
+// isBzip2 reports whether head begins with a bzip2 stream header, followed by
+// the magic number of a compressed block or of the end of the stream.
+func isBzip2(head []byte) bool {
+	return len(head) == 10 && string(head[:3]) == "BZh" && head[3] >= '1' && head[3] <= '9' &&
+		(string(head[4:]) == "\x31\x41\x59\x26\x53\x59" || string(head[4:]) == "\x17\x72\x45\x38\x50\x90")
+}
+
+// isZlib reports whether head begins with a zlib stream header (RFC 1950)
+// for the deflate method, with no preset dictionary.
+func isZlib(head []byte) bool {
+	if len(head) < 2 {
+		return false
+	}
+	cmf, flg := head[0], head[1]
+	return cmf&0x0f == 8 && cmf>>4 <= 7 && flg&0x20 == 0 && (uint(cmf)<<8|uint(flg))%31 == 0
+}
+
+// readFile reads the input file at path and returns the statistics gathered
+// from its records. The special path "-" denotes standard input. If the file
+// cannot be read, the failure is logged and recorded, and readFile returns
+// the statistics gathered before the failure, if any.
+func (ir *inputReader) readFile(path string) *groupSet {
+	gs := ir.newSet()
+	r, name, err := openInput(path)
+	if err != nil {
+		ir.fail(err)
+		return gs
+	}
+	defer r.Close()
+
+	ir.scan(name, r, func(s sample) {
+		gs.AddSample(s)
+		ir.echo(s)
+	})
+	return gs
+}
+
+// readSamples reads the input file at path and returns the samples selected
+// from its records, in order. Failures are handled as for readFile.
+func (ir *inputReader) readSamples(path string) []sample {
+	r, name, err := openInput(path)
+	if err != nil {
+		ir.fail(err)
+		return nil
+	}
+	defer r.Close()
+
+	var out []sample
+	ir.scan(name, r, func(s sample) { out = append(out, s) })
+	return out
+}
+
+// scan reads records from r and calls f with the sample selected from each
+// valid record. Invalid records are rejected (see reject), including those
+// with only some invalid fields, for which f is also called. If reading fails,
+// scan records the failure and returns. Text that precedes a rejected record
+// but is not part of it, such as a CSV header, goes with the next sample.
+func (ir *inputReader) scan(name string, r io.Reader, f func(sample)) {
+	rr, err := newRecordReader(ir.format, r, ir.split)
+	if err != nil {
+		fail("Invalid -format: %v", err)
+	}
+	var head string
+	for {
+		rec, err := rr.Next()
+		var bad *badRecordError
+		if err == io.EOF {
+			return
+		} else if errors.As(err, &bad) {
+			ir.reject(name, bad.line, bad.text, err)
+			continue
+		} else if err != nil {
+			ir.fail(fmt.Errorf("In %s: %w", name, err))
+			return
+		}
+		head += rec.head
+
+		var s sample
+		if ir.pick.count {
+			s.key, s.str, err = ir.pick.PickText(rec)
+		} else {
+			s.key, s.vs, err = ir.pick.Pick(rec)
+		}
+
+		// If only some of the fields are invalid, the others are used, as if
+		// each field were selected by itself, except that a pair for -xy
+		// requires both.
+		var fe *fieldError
+		if errors.As(err, &fe) && s.vs != nil && !ir.opts.xy {
+			s.bad = fe.bad
+		} else if err != nil {
+			ir.reject(name, rec.line, rec.text, err)
+			continue
+		}
+		s.text, s.src, s.line = rec.text, name, rec.line
+		if ir.pick.weight != nil {
+			w, err := ir.pick.Weight(rec)
+			if err != nil {
+				ir.reject(name, rec.line, rec.text, err)
+				continue
+			}
+			s.w = &w
+		}
+		if s.bad != nil {
+			ir.reject(name, rec.line, rec.text, err)
+		}
+		s.head, head = head, ""
+		f(s)
+	}
+}
+
+// reject records that the record at the given line of the named input, with
+// the given text, was rejected because of err. The rejection is logged and
+// counted, and the record is written to the -rejects file, if any. If the
+// error policy does not permit another rejection, reject exits the program.
+func (ir *inputReader) reject(name string, line int, text string, err error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	ir.nbad++
+	if ir.skipped == nil {
+		ir.skipped = make(map[string]int)
+	}
+	ir.skipped[name]++
+	if ir.rejects != nil {
+		if text == "" {
+			text = "# " + err.Error() // the text is not available
+		}
+		fmt.Fprintf(ir.rejects, "%s:%d: %s\n", name, line, strings.TrimRight(text, "\n"))
+	}
+
+	if ir.strict || (ir.maxErrors > 0 && ir.nbad > ir.maxErrors) {
+		ir.flushRejects()
+		if ir.strict {
+			exit(exitBadInput, "In %s: line %d: %v", name, line, err)
+		}
+		log.Printf("In %s: line %d: %v", name, line, err)
+		exit(exitBadInput, "Too many invalid records (more than %d)", ir.maxErrors)
+	}
+	log.Printf("In %s: line %d: %v", name, line, err)
+}
+
+// fail logs err as the failure to read an input, and records the failure.
+func (ir *inputReader) fail(err error) {
+	log.Print(err)
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	ir.failed = true
+}
+
+// finish writes a tally of the rejected records in each input, if any, to w, or
+// to the log if the output format is not text or the state is saved to stdout
+// (where the tally would corrupt it), and flushes the rejects file. It reports
+// whether all the inputs were read successfully.
+func (ir *inputReader) finish(w io.Writer) bool {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	for _, name := range slices.Sorted(maps.Keys(ir.skipped)) {
+		msg := fmt.Sprintf("skipped %d invalid %s in %s", ir.skipped[name], plural(ir.skipped[name], "line"), name)
+		if isText(*outFormat) && *saveFile != "-" {
+			fmt.Fprintln(w, msg)
+		} else {
+			log.Print(msg)
+		}
+	}
+	ir.flushRejects()
+	return !ir.failed
+}
+
+func (ir *inputReader) flushRejects() {
+	if ir.rejects != nil {
+		if err := ir.rejects.Flush(); err != nil {
+			exit(exitIOError, "Writing -rejects: %v", err)
+		}
+	}
+}
+
+func plural(n int, s string) string {
+	if n == 1 {
+		return s
+	}
+	return s + "s"
+}
+
+// echo writes the text of s, preceded by its head, to the output, if -cat is
+// enabled.
+func (ir *inputReader) echo(s sample) {
+	if ir.cat != nil {
+		if _, err := ir.cat.WriteString(s.head + s.text); err != nil {
+			exit(exitIOError, "Output: %v", err)
+		}
+	}
+}
+
+// flush flushes echoed output, if any.
+func (ir *inputReader) flush() {
+	if ir.cat != nil {
+		if err := ir.cat.Flush(); err != nil {
+			log.Printf("Flushing output failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScanRejects(t *testing.T) {
+	fields, err := parseColumns("2")
+	if err != nil {
+		t.Fatalf("Parse fields: %v", err)
+	}
+	var rejects bytes.Buffer
+	ir := &inputReader{
+		split:   regexp.MustCompile(` +`),
+		pick:    newPicker(fields, nil, noUnit, false),
+		rejects: bufio.NewWriter(&rejects),
+	}
+
+	var got []float64
+	for _, in := range []struct{ name, text string }{
+		{"a", "x 1\ny two\nz 3\n"},
+		{"b", "only\nw 4\nv\n"},
+	} {
+		ir.scan(in.name, strings.NewReader(in.text), func(s sample) {
+			got = append(got, s.vs[0].Float())
+		})
+	}
+	if diff := cmp.Diff([]float64{1, 3, 4}, got); diff != "" {
+		t.Errorf("Values (-want, +got):\n%s", diff)
+	}
+
+	var tally bytes.Buffer
+	if !ir.finish(&tally) {
+		t.Error("Finish reported a failure, want success")
+	}
+	if diff := cmp.Diff("skipped 1 invalid line in a\nskipped 2 invalid lines in b\n",
+		tally.String()); diff != "" {
+		t.Errorf("Tally (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("a:2: y two\nb:1: only\nb:3: v\n", rejects.String()); diff != "" {
+		t.Errorf("Rejects (-want, +got):\n%s", diff)
+	}
+
+	// When the state is saved to stdout, the tally is logged instead.
+	setFlags(t, "save-state", "-")
+	tally.Reset()
+	ir.finish(&tally)
+	if tally.Len() != 0 {
+		t.Errorf("Tally with -save-state -: got %q, want empty", tally.String())
+	}
+}
+
+func TestScanMultipleFields(t *testing.T) {
+	fields, err := parseColumns("1,2")
+	if err != nil {
+		t.Fatalf("Parse fields: %v", err)
+	}
+	ir := &inputReader{
+		split: regexp.MustCompile(` +`),
+		pick:  newPicker(fields, nil, noUnit, false),
+	}
+
+	// The valid fields of a record are used even if others are invalid, as if
+	// each field were selected by itself.
+	got := make([][]float64, 2)
+	ir.scan("a", strings.NewReader("1 2\n3 x\ny 4\n5 6\n7\nu v\n"), func(s sample) {
+		for i, v := range s.vs {
+			if s.bad == nil || !s.bad[i] {
+				got[i] = append(got[i], v.Float())
+			}
+		}
+	})
+	if diff := cmp.Diff([][]float64{{1, 3, 5, 7}, {2, 4, 6}}, got); diff != "" {
+		t.Errorf("Values (-want, +got):\n%s", diff)
+	}
+	var tally bytes.Buffer
+	ir.finish(&tally)
+	if diff := cmp.Diff("skipped 4 invalid lines in a\n", tally.String()); diff != "" {
+		t.Errorf("Tally (-want, +got):\n%s", diff)
+	}
+}
+
+func TestScanEchoCSV(t *testing.T) {
+	setFlags(t, "cat", "true")
+	fields, err := parseColumns("v")
+	if err != nil {
+		t.Fatalf("Parse fields: %v", err)
+	}
+	var out bytes.Buffer
+	ir := &inputReader{
+		format: "csv",
+		pick:   newPicker(fields, nil, noUnit, false),
+		cat:    bufio.NewWriter(&out),
+	}
+
+	// The header is echoed with the first valid record, and each record is
+	// echoed exactly as it appears in the input.
+	const input = "name,v\r\nbad,x\r\n\"a, \"\"b\"\"\", 1\r\n\nc,\"2\"\r\nd,3"
+	ir.scan("a", strings.NewReader(input), ir.echo)
+	ir.flush()
+	if diff := cmp.Diff("name,v\r\n\"a, \"\"b\"\"\", 1\r\n\nc,\"2\"\r\nd,3", out.String()); diff != "" {
+		t.Errorf("Echoed input (-want, +got):\n%s", diff)
+	}
+}
+
+func TestReadMissingFile(t *testing.T) {
+	ir := &inputReader{pick: newPicker([]column{{}}, nil, noUnit, false)}
+	gs := ir.readFile(filepath.Join(t.TempDir(), "missing"))
+	if n := gs.groups[""].cs[0].Count(); n != 0 {
+		t.Errorf("Count: got %d, want 0", n)
+	}
+	if ir.finish(new(bytes.Buffer)) {
+		t.Error("Finish reported success, want failure")
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	const text = "1\n2\n3\n"
+	compress := func(newWriter func(io.Writer) io.WriteCloser) string {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		io.WriteString(w, text)
+		w.Close()
+		return buf.String()
+	}
+	// There is no bzip2 writer in the standard library.
+	bz, err := hex.DecodeString("425a6839314159265359125d9f8a000001c800001038002000219a68334d1cb78bb9229c2848092ecfc500")
+	if err != nil {
+		t.Fatalf("Decode bzip2 input: %v", err)
+	}
+
+	gz := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	tests := []struct {
+		name, input, want string
+	}{
+		{"plain", text, text},
+		{"empty", "", ""},
+		{"gzip", gz, text},
+		{"gzip-multi", gz + gz, text + text},
+		{"bzip2", string(bz), text},
+		{"zlib", compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }), text},
+
+		// Text that begins with a valid zlib header.
+		{"zlib-like", "H,1\nH,2\n", "H,1\nH,2\n"},
+		{"bzip2-like", "BZh9 10\n", "BZh9 10\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := decompress(strings.NewReader(tc.input))
+			if err != nil {
+				t.Fatalf("decompress: unexpected error: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("Read: unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("Output (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
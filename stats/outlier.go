@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/creachadair/misctools/stats/summary"
+)
+
+// An outlierFilter identifies outlying values, separately for each group and
+// selected field, by one of these methods:
+//
+//   - iqr: values more than k times the interquartile range below the first
+//     quartile or above the third (Tukey's fences; by default k = 1.5).
+//   - zscore: values more than k standard deviations from the mean (by
+//     default k = 3).
+//   - mad: values whose modified z-score, 0.6745 times the distance from the
+//     median divided by the median absolute deviation, exceeds k (Iglewicz
+//     and Hoaglin; by default k = 3.5).
+//
+// Bounds are computed in float64.
+type outlierFilter struct {
+	method string
+	k      float64
+}
+
+// outlierThresholds are the default thresholds for each method.
+var outlierThresholds = map[string]float64{"iqr": 1.5, "zscore": 3, "mad": 3.5}
+
+// newOutlierFilter returns a filter for the named method and threshold. If
+// k == 0, the default threshold for the method is used.
+func newOutlierFilter(method string, k float64) (*outlierFilter, error) {
+	def, ok := outlierThresholds[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method %q", method)
+	} else if k < 0 {
+		return nil, fmt.Errorf("threshold must not be negative")
+	} else if k == 0 {
+		k = def
+	}
+	return &outlierFilter{method: method, k: k}, nil
+}
+
+// bounds returns the range [lo, hi] of values that are not outliers among
+// vs, which must be sorted.
+func (f *outlierFilter) bounds(vs []float64) (lo, hi float64) {
+	if len(vs) == 0 {
+		return math.Inf(-1), math.Inf(1)
+	}
+	switch f.method {
+	case "iqr":
+		q1, q3 := sortedQuantile(vs, 0.25), sortedQuantile(vs, 0.75)
+		return q1 - f.k*(q3-q1), q3 + f.k*(q3-q1)
+
+	case "zscore":
+		var s summary.Float
+		for _, v := range vs {
+			s.Add(v)
+		}
+		sd := math.Sqrt(s.Var())
+		if s.Count() < 2 || sd == 0 {
+			break
+		}
+		return s.Mean() - f.k*sd, s.Mean() + f.k*sd
+
+	case "mad":
+		med := sortedQuantile(vs, 0.5)
+		devs := make([]float64, len(vs))
+		for i, v := range vs {
+			devs[i] = math.Abs(v - med)
+		}
+		slices.Sort(devs)
+		mad := sortedQuantile(devs, 0.5)
+		if mad == 0 {
+			break // the modified z-score is not defined
+		}
+		d := f.k * mad / 0.6745
+		return med - d, med + d
+	}
+	return math.Inf(-1), math.Inf(1)
+}
+
+// sortedQuantile returns the value at quantile q of vs, which must be sorted
+// and non-empty, interpolating as exactQuantiler does.
+func sortedQuantile(vs []float64, q float64) float64 {
+	pos := q * float64(len(vs)-1)
+	h := int(pos)
+	if h >= len(vs)-1 {
+		return vs[len(vs)-1]
+	}
+	return vs[h] + (vs[h+1]-vs[h])*(pos-float64(h))
+}
+
+// An outlier is a selected value identified as an outlier.
+type outlier struct {
+	sample         // the sample containing the value
+	field  int     // the index of the field in the sample
+	lo, hi float64 // the bounds of non-outlying values
+}
+
+// Find returns the outliers among samples, each of which has nfields values,
+// in order of the samples.
+func (f *outlierFilter) Find(samples []sample, nfields int) []outlier {
+	// Gather the values for each group and field, and compute their bounds.
+	type span struct{ lo, hi float64 }
+	vals := make(map[string][][]float64)
+	for _, s := range samples {
+		id := strings.Join(s.key, "\x00")
+		if vals[id] == nil {
+			vals[id] = make([][]float64, nfields)
+		}
+		for i, v := range s.vs {
+			if s.bad == nil || !s.bad[i] {
+				vals[id][i] = append(vals[id][i], v.Float())
+			}
+		}
+	}
+	bounds := make(map[string][]span)
+	for id, fvs := range vals {
+		bounds[id] = make([]span, nfields)
+		for i, vs := range fvs {
+			slices.Sort(vs)
+			bounds[id][i].lo, bounds[id][i].hi = f.bounds(vs)
+		}
+	}
+
+	var out []outlier
+	for _, s := range samples {
+		b := bounds[strings.Join(s.key, "\x00")]
+		for i, v := range s.vs {
+			if s.bad != nil && s.bad[i] {
+				continue
+			} else if x := v.Float(); x < b[i].lo || x > b[i].hi {
+				out = append(out, outlier{sample: s, field: i, lo: b[i].lo, hi: b[i].hi})
+			}
+		}
+	}
+	return out
+}
+
+// filterOutliers finds the outliers among samples, and returns the set of
+// groups for the remaining samples, or for all samples if -drop-outliers is
+// not set. Samples are echoed for -cat, with outliers prefixed by -mark.
+func (ir *inputReader) filterOutliers(f *outlierFilter, samples []sample) (*groupSet, []outlier) {
+	type pos struct {
+		src  string
+		line int
+	}
+	out := f.Find(samples, len(ir.pick.fields))
+	isOut := make(map[pos]bool)
+	for _, o := range out {
+		isOut[pos{o.src, o.line}] = true
+	}
+	gs := ir.newSet()
+	for _, s := range samples {
+		if isOut[pos{s.src, s.line}] {
+			if *dropOutliers {
+				ir.echo(sample{head: s.head}) // keep a CSV header, if any
+				continue
+			} else if s.text != "" {
+				s.text = *outlierMark + s.text
+			}
+		}
+		gs.AddSample(s)
+		ir.echo(s)
+	}
+	ir.flush()
+	return gs, out
+}
+
+// writeOutliers writes a description of each outlier to w, if the output
+// format is text, or to the log otherwise. If -drop-outliers is set, it
+// writes only the number of samples dropped.
+func (r *reporter) writeOutliers(w io.Writer, out []outlier) {
+	emit := func(msg string) {
+		if isText(*outFormat) {
+			fmt.Fprintln(w, msg)
+		} else {
+			log.Print(msg)
+		}
+	}
+	if *dropOutliers {
+		if len(out) != 0 {
+			n := 0
+			for i, o := range out {
+				if i == 0 || o.src != out[i-1].src || o.line != out[i-1].line {
+					n++
+				}
+			}
+			emit(fmt.Sprintf("dropped %d %s with outlying values", n, plural(n, "record")))
+		}
+		return
+	}
+	units := r.pick.Units()
+	for _, o := range out {
+		format := units[o.field].Format
+		msg := fmt.Sprintf("outlier in %s: line %d: ", o.src, o.line)
+		if len(r.fields) > 1 {
+			msg += fmt.Sprintf("field %s: ", r.fields[o.field])
+		}
+		msg += fmt.Sprintf("%s is outside [%s, %s]", format(o.vs[o.field].Rat()),
+			format(ratFloat(o.lo)), format(ratFloat(o.hi)))
+		emit(msg)
+	}
+}
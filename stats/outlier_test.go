@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOutlierBounds(t *testing.T) {
+	vs := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 100} // sorted
+	inf := math.Inf(1)
+	tests := []struct {
+		method string
+		k      float64
+		vs     []float64
+		lo, hi float64
+	}{
+		{"iqr", 0, vs, 3.25 - 1.5*4.5, 7.75 + 1.5*4.5},
+		{"iqr", 1, vs, 3.25 - 4.5, 7.75 + 4.5},
+		{"zscore", 1, []float64{2, 4, 4, 4, 5, 5, 7, 9}, 5 - math.Sqrt(32.0/7), 5 + math.Sqrt(32.0/7)},
+		{"mad", 0, vs, 5.5 - 3.5*2.5/0.6745, 5.5 + 3.5*2.5/0.6745},
+
+		// Cases where the bounds are not defined.
+		{"iqr", 0, nil, -inf, inf},
+		{"zscore", 0, []float64{3}, -inf, inf},
+		{"zscore", 0, []float64{3, 3, 3}, -inf, inf},
+		{"mad", 0, []float64{1, 2, 2, 2, 9}, -inf, inf},
+	}
+	for _, tc := range tests {
+		f, err := newOutlierFilter(tc.method, tc.k)
+		if err != nil {
+			t.Fatalf("newOutlierFilter(%q, %v): %v", tc.method, tc.k, err)
+		}
+		lo, hi := f.bounds(tc.vs)
+		if math.Abs(lo-tc.lo) > 1e-9 || math.Abs(hi-tc.hi) > 1e-9 {
+			t.Errorf("%s(k=%v) bounds %v: got [%v, %v], want [%v, %v]",
+				tc.method, tc.k, tc.vs, lo, hi, tc.lo, tc.hi)
+		}
+	}
+
+	if _, err := newOutlierFilter("bogus", 0); err == nil {
+		t.Error("newOutlierFilter(bogus): got nil error, want error")
+	}
+	if _, err := newOutlierFilter("iqr", -1); err == nil {
+		t.Error("newOutlierFilter(iqr, -1): got nil error, want error")
+	}
+}
+
+func TestFindOutliers(t *testing.T) {
+	var samples []sample
+	add := func(key string, x, y float64) {
+		samples = append(samples, sample{
+			key:  []string{key},
+			vs:   []value{floatValue(x), floatValue(y)},
+			src:  "in",
+			line: len(samples) + 1,
+		})
+	}
+	for _, v := range []float64{10, 11, 12, 10, 11} {
+		add("a", v, v)
+		add("b", -v, v)
+	}
+	add("a", 50, 11)  // outlier in field 0 of a
+	add("b", -11, 50) // outlier in field 1 of b
+	add("a", 12, -10) // outlier in field 1 of a, but not of b
+
+	f, err := newOutlierFilter("iqr", 0)
+	if err != nil {
+		t.Fatalf("newOutlierFilter: %v", err)
+	}
+	var got [][2]int // line, field
+	for _, o := range f.Find(samples, 2) {
+		got = append(got, [2]int{o.line, o.field})
+	}
+	if diff := cmp.Diff([][2]int{{11, 0}, {12, 1}, {13, 1}}, got); diff != "" {
+		t.Errorf("Outliers (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Structured output formats (-o json, csv, tsv) emit one record for each
+// combination of group and selected field, with these fields in order:
+//
+//   - key: the values of the grouping key fields, if -by is set. In JSON this
+//     is an object mapping each key column name to its value; in CSV and TSV
+//     each key column is a separate column named for the key. A key column
+//     given by position N is named "fN". With -time, the key is the start of
+//     the time bucket, named "time".
+//
+//   - field: the name or position of the selected field.
+//
+//   - statistics: one value for each statistic reported, named as in the text
+//     output (n, weight, sum, min, max, range, avg, gmean, hmean, mode, var,
+//     sdv, sem, ciNN_lo and ciNN_hi for the -ci level, cv, skew, kurt, med, q1,
+//     q2, q3, and pNN for each percentile given by -pct). In JSON these are
+//     members of an object named "stats". Values are formatted as strings
+//     without regard to -prec: with -exact, as exact rationals such as "7/3";
+//     otherwise, and for values that are inherently approximate, such as sdv,
+//     as the shortest decimal that identifies the float64 value, such as
+//     "2.3333333333333335". Values that are undefined (for example, the minimum
+//     of an empty input) are JSON null or empty in CSV and TSV.
+//
+// With -count, the statistics are n and distinct, and the records for the
+// summaries are followed by a record for each of the most frequent values of
+// each group, whose key has an extra "value" column, and whose statistics are
+// count, pct, and with -stream, err. In CSV and TSV, these records follow a
+// blank line and a header of their own.
+//
+// With -xy, there is one record for each group, whose field is the -xy
+// argument, and the statistics are n, cov, pearson, spearman, slope,
+// intercept, and r2.
+//
+// JSON output has one object per line. CSV and TSV output begins with a header
+// line naming the columns. With -compare, the records for the summaries, which
+// have an extra "file" key, are followed by the comparison records, whose
+// statistics are delta, change, welch_t, welch_p, mwu_u, and mwu_p; in CSV and
+// TSV, the comparison records follow a blank line and a header of their own.
+
+// formatResults formats rs as a single line of comma-separated key=value pairs.
+func formatResults(rs []result) string {
+	out := make([]string, len(rs))
+	for i, r := range rs {
+		out[i] = r.key + "=" + r.value
+	}
+	return strings.Join(out, ", ")
+}
+
+// A reporter writes reports of the statistics gathered from the input.
+type reporter struct {
+	pick         *picker
+	pcts         []percentile
+	edges        []*big.Rat // explicit histogram edges, if any
+	fields, keys []column
+}
+
+// output writes a report of the statistics in gs to w, or with -save-state,
+// saves their state.
+func (r *reporter) output(w io.Writer, gs *groupSet) error {
+	if *saveFile != "" {
+		return saveState(*saveFile, gs, r)
+	}
+	return r.write(w, gs)
+}
+
+// A dataError reports that the statistics of the input cannot be reported as
+// requested, for example a log-scale histogram of non-positive values, as
+// distinct from a failure to write the output.
+type dataError struct{ error }
+
+func (e dataError) Unwrap() error { return e.error }
+
+// write writes a report of the statistics in gs to w, in the format and
+// with the options selected by the command-line flags.
+func (r *reporter) write(w io.Writer, gs *groupSet) error {
+	if r.pick.time != nil {
+		if err := r.pick.time.Fill(gs); err != nil {
+			return dataError{err}
+		}
+	}
+	units := r.pick.Units()
+	reports, err := gs.Report(r.pcts, units, *sortBy, *topK)
+	if err != nil {
+		return dataError{err}
+	}
+	if err := writeReport(w, *outFormat, reports, r.fields, r.keys); err != nil {
+		return err
+	} else if r.pick.count {
+		return r.writeCounts(w, reports)
+	}
+	if *doHist {
+		if err := r.writeHistograms(w, reports, units); err != nil {
+			return err
+		}
+	}
+	if *doSpark || *doPlot {
+		return r.writeCharts(w, reports, units)
+	}
+	return nil
+}
+
+// writeHistograms writes a histogram of each field of each group in reports
+// to w.
+func (r *reporter) writeHistograms(w io.Writer, reports []groupReport, units []unitKind) error {
+	for _, gr := range reports {
+		for i, c := range gr.cs {
+			if c.Count() == 0 {
+				continue
+			}
+			if len(gr.cs) > 1 || len(r.keys) != 0 {
+				fmt.Fprintf(w, "\n%s:\n", histLabel(gr.key, r.fields[i]))
+			}
+			bs, err := c.Histogram(r.edges, *nBuckets, *logScale)
+			if err != nil {
+				return dataError{fmt.Errorf("histogram: %w", err)}
+			}
+			if err := writeHistogram(w, bs, terminalWidth(), units[i].Format); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeReport writes the reports for a set of groups to w in the specified
+// output format.
+func writeReport(w io.Writer, format string, reports []groupReport, fields, keys []column) error {
+	switch format {
+	case "", "text":
+		return writeText(w, reports, fields, keys)
+	case "json":
+		return writeJSON(w, reports, fields, keys)
+	case "csv":
+		return writeCSV(w, ',', reports, fields, keys)
+	case "tsv":
+		return writeCSV(w, '\t', reports, fields, keys)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// writeText writes reports as text. A single report for a single field is
+// written as one line of key=value pairs; otherwise the reports are written
+// as a table with one row per group and field.
+func writeText(w io.Writer, reports []groupReport, fields, keys []column) error {
+	if len(reports) == 1 && len(fields) == 1 && len(keys) == 0 {
+		_, err := fmt.Fprintln(w, formatResults(reports[0].results[0]))
+		return err
+	}
+	var rows [][]result
+	for _, gr := range reports {
+		for i, rs := range gr.results {
+			var row []result
+			for j, k := range gr.key {
+				row = append(row, result{key: keyLabel(keys[j]), value: k})
+			}
+			if len(fields) > 1 {
+				row = append(row, result{key: "field", value: fields[i].String()})
+			}
+			rows = append(rows, append(row, rs...))
+		}
+	}
+	return writeTable(w, rows)
+}
+
+// writeJSON writes reports as JSON Lines, one object per group and field.
+func writeJSON(w io.Writer, reports []groupReport, fields, keys []column) error {
+	var buf bytes.Buffer
+	for _, gr := range reports {
+		for i, rs := range gr.results {
+			buf.Reset()
+			buf.WriteByte('{')
+			if len(keys) != 0 {
+				buf.WriteString(`"key":{`)
+				for j, k := range gr.key {
+					if j > 0 {
+						buf.WriteByte(',')
+					}
+					fmt.Fprintf(&buf, "%s:%s", jsonString(keyLabel(keys[j])), jsonString(k))
+				}
+				buf.WriteString("},")
+			}
+			fmt.Fprintf(&buf, `"field":%s,"stats":{`, jsonString(fields[i].String()))
+			for j, r := range rs {
+				if j > 0 {
+					buf.WriteByte(',')
+				}
+				v := "null"
+				if r.num != nil {
+					v = jsonString(numString(r))
+				}
+				fmt.Fprintf(&buf, "%s:%s", jsonString(r.key), v)
+			}
+			buf.WriteString("}}\n")
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// numString formats the value of r for structured output. Integers and, in
+// -exact mode, exact values are formatted exactly; other values are formatted
+// as float64.
+func numString(r result) string {
+	if r.num.IsInt() || (*exactMath && !r.approx) {
+		return r.num.RatString()
+	}
+	f, _ := r.num.Float64()
+	format := byte('f')
+	if abs := math.Abs(f); abs < 1e-6 || abs >= 1e21 {
+		format = 'e' // as encoding/json does for float64
+	}
+	return strconv.FormatFloat(f, format, -1, 64)
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// writeCSV writes reports as CSV records separated by comma, with a header.
+func writeCSV(w io.Writer, comma rune, reports []groupReport, fields, keys []column) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	for n, gr := range reports {
+		for i, rs := range gr.results {
+			if n == 0 && i == 0 {
+				var header []string
+				for _, k := range keys {
+					header = append(header, keyLabel(k))
+				}
+				header = append(header, "field")
+				for _, r := range rs {
+					header = append(header, r.key)
+				}
+				cw.Write(header)
+			}
+			row := append(slices.Clone(gr.key), fields[i].String())
+			for _, r := range rs {
+				if r.num == nil {
+					row = append(row, "")
+				} else {
+					row = append(row, numString(r))
+				}
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// keyLabel returns the table heading for the key column c.
+func keyLabel(c column) string {
+	if c.name != "" {
+		return c.name
+	}
+	return fmt.Sprintf("f%d", c.index)
+}
+
+// histLabel returns a label for the histogram of the given group key and
+// field.
+func histLabel(key []string, field column) string {
+	if len(key) == 0 {
+		return fmt.Sprintf("field %s", field)
+	}
+	return fmt.Sprintf("%s (field %s)", strings.Join(key, " "), field)
+}
+
+// writeTable writes rows to w as a column-aligned table, with a header line
+// giving the keys of the first row. All rows must have the same keys.
+func writeTable(w io.Writer, rows [][]result) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	keys := make([]string, len(rows[0]))
+	for i, r := range rows[0] {
+		keys[i] = r.key
+	}
+	fmt.Fprintln(tw, strings.Join(keys, "\t")+"\t")
+	for _, row := range rows {
+		vals := make([]string, len(row))
+		for i, r := range row {
+			vals[i] = r.value
+		}
+		fmt.Fprintln(tw, strings.Join(vals, "\t")+"\t")
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var updateGolden = flag.Bool("update", false, "Update golden output files")
+
+// setFlags sets command-line flags for the duration of a test.
+func setFlags(t *testing.T, kv ...string) {
+	t.Helper()
+	for i := 0; i+1 < len(kv); i += 2 {
+		old := flag.Lookup(kv[i]).Value.String()
+		if err := flag.Set(kv[i], kv[i+1]); err != nil {
+			t.Fatalf("Set flag %q: %v", kv[i], err)
+		}
+		t.Cleanup(func() { flag.Set(kv[i], old) })
+	}
+}
+
+// readGroups reads the named test input using the given column selections.
+func readGroups(t *testing.T, name, format, fieldSpec, keySpec string) (*groupSet, []column, []column) {
+	t.Helper()
+	fields, err := parseColumns(fieldSpec)
+	if err != nil {
+		t.Fatalf("Parse fields: %v", err)
+	}
+	var keys []column
+	if keySpec != "" {
+		keys, err = parseColumns(keySpec)
+		if err != nil {
+			t.Fatalf("Parse keys: %v", err)
+		}
+	}
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Open input: %v", err)
+	}
+	defer f.Close()
+	rr, err := newRecordReader(format, f, nil)
+	if err != nil {
+		t.Fatalf("New reader: %v", err)
+	}
+
+	p := newPicker(fields, keys, noUnit, true)
+	gs := newGroupSet(len(fields), collectOptions{exact: true, quantiles: true})
+	for {
+		rec, err := rr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if key, vs, err := p.Pick(rec); err == nil {
+			gs.Add(key, vs)
+		}
+	}
+	return gs, fields, keys
+}
+
+func TestGoldenOutput(t *testing.T) {
+	setFlags(t, "exact", "true", "sum", "true", "min", "true", "max", "true",
+		"mean", "true", "var", "true", "median", "true")
+	pcts, err := parsePercentiles("90")
+	if err != nil {
+		t.Fatalf("Parse percentiles: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		fields, keys string
+	}{
+		{"single", "latency_ms", ""},
+		{"multi", "latency_ms,bytes", ""},
+		{"grouped", "latency_ms", "endpoint,2"},
+	}
+	for _, tc := range tests {
+		gs, fields, keys := readGroups(t, "requests.csv", "csv", tc.fields, tc.keys)
+		if len(keys) == 0 {
+			gs.Add(nil, nil)
+		}
+		reports, err := gs.Report(pcts, make([]unitKind, len(fields)), "key", 0)
+		if err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+		for _, format := range []string{"text", "json", "csv", "tsv"} {
+			t.Run(tc.name+"/"+format, func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := writeReport(&buf, format, reports, fields, keys); err != nil {
+					t.Fatalf("writeReport: %v", err)
+				}
+				path := filepath.Join("testdata", tc.name+"."+format)
+				if *updateGolden {
+					if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+						t.Fatalf("Update golden file: %v", err)
+					}
+					return
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("Read golden file: %v", err)
+				}
+				if diff := cmp.Diff(string(want), buf.String()); diff != "" {
+					t.Errorf("Output (-want, +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
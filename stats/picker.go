@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+type picker struct {
+	fields []column // value fields
+	keys   []column // grouping key fields
+
+	// If expr != nil, it is evaluated to give the value of the single
+	// selected field, instead of reading the field.
+	expr *expr
+
+	// If time != nil, the label of the time bucket of each record is the
+	// first component of its grouping key.
+	time *timeBucketer
+
+	// If weight != nil, it is the field giving the weight of the values of
+	// each record.
+	weight *column
+
+	// If count is true, the single selected field is a text value to be
+	// counted (see PickText), rather than a number.
+	count bool
+
+	// If exact is true, values are parsed as rationals; otherwise as float64.
+	exact bool
+
+	// If units != noUnit, values are parsed as quantities with units.
+	// In autoUnit mode, found records the kind of unit detected for each
+	// field, and every value of the field must have the same kind.
+	units unitKind
+	found []atomic.Int32
+}
+
+func newPicker(fields, keys []column, units unitKind, exact bool) *picker {
+	return &picker{
+		fields: fields,
+		keys:   keys,
+		exact:  exact,
+		units:  units,
+		found:  make([]atomic.Int32, len(fields)),
+	}
+}
+
+// Units returns the kind of units for each selected field.
+func (p *picker) Units() []unitKind {
+	out := make([]unitKind, len(p.fields))
+	for i := range out {
+		if p.units == autoUnit {
+			out[i] = unitKind(p.found[i].Load())
+		} else {
+			out[i] = p.units
+		}
+	}
+	return out
+}
+
+// Pick returns the values selected by the current settings from rec, one for
+// each selected field in order, along with the grouping key fields, if any,
+// preceded by the time bucket label if time bucketing is enabled. If some but
+// not all of several selected fields are invalid, Pick returns the values of
+// the others, with a *fieldError identifying the invalid fields.
+func (p *picker) Pick(rec *record) (key []string, vs []value, _ error) {
+	key, err := p.key(rec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.expr != nil {
+		r, err := p.expr.Eval(rec)
+		if err != nil {
+			return nil, nil, err
+		} else if p.exact {
+			return key, []value{ratValue(r)}, nil
+		}
+		v, err := approxValue(r.RatString(), r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, []value{v}, nil
+	}
+
+	vs = make([]value, len(p.fields))
+	var fe *fieldError
+	for i, c := range p.fields {
+		s, err := rec.Get(c)
+		if err == nil {
+			vs[i], err = p.parseValue(i, s)
+		}
+		if err == nil {
+			continue
+		} else if len(p.fields) == 1 {
+			return nil, nil, err
+		} else if fe == nil {
+			fe = &fieldError{bad: make([]bool, len(p.fields))}
+		}
+		fe.bad[i] = true
+		fe.errs = append(fe.errs, fmt.Errorf("field %s: %w", c, err))
+	}
+	if fe == nil {
+		return key, vs, nil
+	} else if len(fe.errs) == len(p.fields) {
+		return nil, nil, fe // no valid fields
+	}
+	return key, vs, fe
+}
+
+// A fieldError reports that some of the selected fields of a record are
+// invalid.
+type fieldError struct {
+	bad  []bool  // bad[i] reports whether field i is invalid
+	errs []error // the errors for the invalid fields, in order
+}
+
+func (e *fieldError) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Weight returns the weight of the values selected from rec. A weight is a
+// plain number, and must not be negative.
+func (p *picker) Weight(rec *record) (value, error) {
+	s, err := rec.Get(*p.weight)
+	if err != nil {
+		return value{}, fmt.Errorf("weight %w", err)
+	}
+	var w value
+	s = strings.TrimSpace(s)
+	if p.exact {
+		r, err := parseValue(s)
+		if err != nil {
+			return value{}, fmt.Errorf("weight: %w", err)
+		}
+		w = ratValue(r)
+	} else if w, err = parseFloat(s); err != nil {
+		return value{}, fmt.Errorf("weight: %w", err)
+	}
+	if w.Sign() < 0 {
+		return value{}, fmt.Errorf("negative weight %q", s)
+	}
+	return w, nil
+}
+
+// PickText returns the text of the single selected field of rec, and the
+// grouping key as for Pick.
+func (p *picker) PickText(rec *record) (key []string, text string, _ error) {
+	key, err := p.key(rec)
+	if err != nil {
+		return nil, "", err
+	}
+	s, err := rec.Get(p.fields[0])
+	if err != nil {
+		return nil, "", err
+	}
+	return key, strings.TrimSpace(s), nil
+}
+
+// key returns the grouping key of rec, preceded by its time bucket label if
+// time bucketing is enabled.
+func (p *picker) key(rec *record) ([]string, error) {
+	var key []string
+	if p.time != nil {
+		ts, err := rec.Get(p.time.field)
+		if err != nil {
+			return nil, fmt.Errorf("time %w", err)
+		}
+		k, err := p.time.Key(ts)
+		if err != nil {
+			return nil, err
+		}
+		key = append(key, k)
+	}
+	for _, c := range p.keys {
+		k, err := rec.Get(c)
+		if err != nil {
+			return nil, fmt.Errorf("key %w", err)
+		}
+		key = append(key, k)
+	}
+	return key, nil
+}
+
+// parseValue parses s as the value of the ith selected field.
+func (p *picker) parseValue(i int, s string) (value, error) {
+	if p.units == noUnit {
+		if p.exact {
+			v, err := parseValue(s)
+			return ratValue(v), err
+		}
+		return parseFloat(s)
+	}
+	v, kind, err := parseQuantity(s, p.units)
+	if err != nil {
+		return value{}, err
+	} else if p.units == autoUnit && kind != noUnit {
+		if !p.found[i].CompareAndSwap(0, int32(kind)) {
+			if old := unitKind(p.found[i].Load()); old != kind {
+				return value{}, fmt.Errorf("%s value %q does not match earlier %s values", kind, s, old)
+			}
+		}
+	}
+	if p.exact {
+		return ratValue(v), nil
+	}
+	return approxValue(s, v)
+}
+
+func parseValue(s string) (*big.Rat, error) {
+	v, ok := big.NewRat(0, 1).SetString(s)
+	if ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("invalid number format for %q", s)
+}
+
+// parseFloat parses s as a float64, or as a rational if it is an integer
+// that float64 cannot represent exactly (see approxValue). It accepts the
+// same formats as parseValue, but does not accept infinities or NaN.
+func parseFloat(s string) (value, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || (f == math.Trunc(f) && math.Abs(f) >= maxExactInt) {
+		// Fall back to the rational parser for formats ParseFloat does not
+		// handle, such as fractions ("3/4"), and for integers ParseFloat may
+		// have rounded. Values out of range for float64 are rejected by
+		// approxValue.
+		v, err := parseValue(s)
+		if err != nil {
+			return value{}, err
+		}
+		return approxValue(s, v)
+	}
+	return checkFloat(s, f)
+}
+
+// approxValue returns r, parsed from s, as a float64 value, unless r is an
+// integer that fits in an int64 but not exactly in a float64. Such integers,
+// like byte counts or timestamps in nanoseconds, are kept exact, so that the
+// statistics of integer values are exact (see collector).
+func approxValue(s string, r *big.Rat) (value, error) {
+	if r.IsInt() && r.Num().IsInt64() {
+		if n := r.Num().Int64(); n < -maxExactInt || n > maxExactInt {
+			return ratValue(r), nil
+		}
+	}
+	return checkFloat(s, ratValue(r).Float())
+}
+
+// checkFloat reports an error if f, parsed from s, is not finite.
+func checkFloat(s string, f float64) (value, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return value{}, fmt.Errorf("value %q is not a finite float64", s)
+	}
+	return floatValue(f), nil
+}
+
+// A column identifies a field of an input record, either by its 1-based
+// position or by name. Position 0 denotes the entire record.
+type column struct {
+	index int
+	name  string // a CSV header name or JSON path; if set, index is ignored
+}
+
+func (c column) String() string {
+	if c.name != "" {
+		return c.name
+	}
+	return strconv.Itoa(c.index)
+}
+
+// parseColumns parses a comma-separated list of columns. Each column is a
+// 1-based field number, an inclusive range of field numbers like "4-6", or a
+// name. The special field 0, meaning the entire line, may only be used by
+// itself.
+func parseColumns(s string) ([]column, error) {
+	var out []column
+	for f := range strings.SplitSeq(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || f[0] < '0' || f[0] > '9' {
+			if f == "" || strings.HasPrefix(f, "-") {
+				return nil, fmt.Errorf("invalid field %q", f)
+			}
+			out = append(out, column{name: f})
+			continue
+		}
+		lo, hi, isRange := strings.Cut(f, "-")
+		a, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field %q", f)
+		}
+		b := a
+		if isRange {
+			b, err = strconv.Atoi(hi)
+			if err != nil || b < a || a == 0 {
+				return nil, fmt.Errorf("invalid field range %q", f)
+			}
+		}
+		for i := a; i <= b; i++ {
+			out = append(out, column{index: i})
+		}
+	}
+	if len(out) > 1 {
+		for _, c := range out {
+			if c.name == "" && c.index == 0 {
+				return nil, fmt.Errorf("field 0 cannot be combined with other fields")
+			}
+		}
+	}
+	return out, nil
+}
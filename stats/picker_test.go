@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseColumns(t *testing.T) {
+	idx := func(is ...int) []column {
+		var out []column
+		for _, i := range is {
+			out = append(out, column{index: i})
+		}
+		return out
+	}
+	tests := []struct {
+		input string
+		want  []column
+	}{
+		{"0", idx(0)},
+		{"3", idx(3)},
+		{"2,3,5", idx(2, 3, 5)},
+		{"2-6", idx(2, 3, 4, 5, 6)},
+		{"1, 4-5,9", idx(1, 4, 5, 9)},
+		{"latency", []column{{name: "latency"}}},
+		{".timing.total_ms,2", []column{{name: ".timing.total_ms"}, {index: 2}}},
+	}
+	for _, tc := range tests {
+		got, err := parseColumns(tc.input)
+		if err != nil {
+			t.Errorf("parseColumns(%q): unexpected error: %v", tc.input, err)
+		} else if !slices.Equal(got, tc.want) {
+			t.Errorf("parseColumns(%q): got %v, want %v", tc.input, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "-1", "3-1", "0-2", "0,1", "2-", "2x"} {
+		if got, err := parseColumns(bad); err == nil {
+			t.Errorf("parseColumns(%q): got %v, want error", bad, got)
+		}
+	}
+}
+
+func TestPickFormats(t *testing.T) {
+	tests := []struct {
+		format, input string
+		cols          string
+		want          []string
+	}{
+		{"csv", "name,v,w\n\"a, b\",1,2\n", "name,w", []string{"a, b", "2"}},
+		{"csv", "name,v,w\n\"a, b\",1,2\n", "3,v", []string{"2", "1"}},
+		{"tsv", "name\tv\nx y\t 3 \n", "v,name", []string{"3", "x y"}},
+		{"jsonl", `{"a":{"b":[5,{"c":"q"}]},"n":2.5}` + "\n", ".a.b.1.c,n,.a.b.0", []string{"q", "2.5", "5"}},
+	}
+	for _, tc := range tests {
+		cols, err := parseColumns(tc.cols)
+		if err != nil {
+			t.Fatalf("parseColumns(%q): %v", tc.cols, err)
+		}
+		rr, err := newRecordReader(tc.format, strings.NewReader(tc.input), nil)
+		if err != nil {
+			t.Fatalf("newRecordReader(%q): %v", tc.format, err)
+		}
+		rec, err := rr.Next()
+		if err != nil {
+			t.Fatalf("Next: unexpected error: %v", err)
+		}
+		var got []string
+		for _, c := range cols {
+			s, err := rec.Get(c)
+			if err != nil {
+				t.Errorf("Get(%v): unexpected error: %v", c, err)
+			}
+			got = append(got, s)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s %q: got %q, want %q", tc.format, tc.cols, got, tc.want)
+		}
+		if _, err := rr.Next(); err != io.EOF {
+			t.Errorf("Next: got %v, want EOF", err)
+		}
+	}
+}
+
+func TestParseFloat(t *testing.T) {
+	for in, want := range map[string]float64{
+		"1.5": 1.5, "-2e3": -2000, "3/4": 0.75, "0": 0, "+7": 7,
+	} {
+		got, err := parseFloat(in)
+		if err != nil {
+			t.Errorf("parseFloat(%q): unexpected error: %v", in, err)
+		} else if got.f != want || got.r != nil {
+			t.Errorf("parseFloat(%q): got %+v, want %v", in, got, want)
+		}
+	}
+
+	// Integers that float64 cannot represent exactly are kept exact if they
+	// fit in an int64.
+	for in, want := range map[string]string{
+		"9007199254740993": "9007199254740993", "-1700000000123456789": "-1700000000123456789",
+		"9007199254740992": "", "1e300": "", "9223372036854775808": "",
+	} {
+		got, err := parseFloat(in)
+		if err != nil {
+			t.Errorf("parseFloat(%q): unexpected error: %v", in, err)
+		} else if want == "" && got.r != nil {
+			t.Errorf("parseFloat(%q): got %v, want a float64", in, got.r)
+		} else if want != "" && (got.r == nil || got.r.RatString() != want) {
+			t.Errorf("parseFloat(%q): got %+v, want exact %s", in, got, want)
+		}
+	}
+	for _, bad := range []string{"", "x", "inf", "NaN", "1e400", "1/0"} {
+		if got, err := parseFloat(bad); err == nil {
+			t.Errorf("parseFloat(%q): got %+v, want error", bad, got)
+		}
+	}
+}
+
+// BenchmarkCollect measures the throughput of parsing and accumulating
+// values in exact and float64 mode.
+func BenchmarkCollect(b *testing.B) {
+	rng := rand.New(rand.NewPCG(1, 1))
+	var input []*record
+	for range 4096 {
+		text := strconv.FormatFloat(rng.ExpFloat64()*100, 'f', 3, 64)
+		input = append(input, &record{kind: textRecord, text: text})
+	}
+	cols := []column{{index: 0}}
+
+	for _, exact := range []bool{false, true} {
+		name := "Float"
+		if exact {
+			name = "Exact"
+		}
+		b.Run(name, func(b *testing.B) {
+			p := newPicker(cols, nil, noUnit, exact)
+			c := newCollector(collectOptions{exact: exact})
+			for i := 0; b.Loop(); i++ {
+				_, vs, err := p.Pick(input[i%len(input)])
+				if err != nil {
+					b.Fatalf("Pick: %v", err)
+				}
+				c.Add(vs[0])
+			}
+		})
+	}
+}
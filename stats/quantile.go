@@ -0,0 +1,372 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A quantiler accumulates values and reports quantiles of their distribution.
+type quantiler interface {
+	// Add adds v to the distribution.
+	Add(v value)
+
+	// AddWeighted adds v to the distribution with weight w > 0. Adding v with
+	// an integer weight k is equivalent to adding it k times.
+	AddWeighted(v, w value)
+
+	// Quantile returns the value at quantile q (0 ≤ q ≤ 1), or nil if no
+	// values have been added.
+	Quantile(q *big.Rat) *big.Rat
+
+	// Merge adds the values from another quantiler of the same kind.
+	Merge(quantiler)
+}
+
+// newQuantiler returns a quantiler that retains all values if exact is true,
+// or a bounded-memory estimator otherwise.
+func newQuantiler(exact bool) quantiler {
+	if exact {
+		return new(exactQuantiler)
+	}
+	return &digestQuantiler{d: newDigest(digestCompression)}
+}
+
+// exactQuantiler computes quantiles exactly by retaining all values.
+type exactQuantiler struct {
+	vs     []value
+	ws     []*big.Rat // weights of vs, or nil if all are 1
+	cum    []*big.Rat // cum[i] is the total weight of vs[:i], when sorted
+	sorted bool
+}
+
+var unitWeight = big.NewRat(1, 1)
+
+func (e *exactQuantiler) Add(v value) {
+	e.vs = append(e.vs, v)
+	if e.ws != nil {
+		e.ws = append(e.ws, unitWeight)
+	}
+	e.sorted = false
+}
+
+func (e *exactQuantiler) AddWeighted(v, w value) {
+	r := w.Rat()
+	if e.ws == nil && r.Cmp(unitWeight) == 0 {
+		e.Add(v)
+		return
+	}
+	e.weigh()
+	e.vs = append(e.vs, v)
+	e.ws = append(e.ws, r)
+	e.sorted = false
+}
+
+// weigh populates e.ws with unit weights if it is nil.
+func (e *exactQuantiler) weigh() {
+	if e.ws == nil {
+		e.ws = make([]*big.Rat, len(e.vs), cap(e.vs))
+		for i := range e.ws {
+			e.ws[i] = unitWeight
+		}
+	}
+}
+
+func (e *exactQuantiler) Merge(q quantiler) {
+	o := q.(*exactQuantiler)
+	if o.ws != nil {
+		e.weigh()
+		e.ws = append(e.ws, o.ws...)
+	} else if e.ws != nil {
+		for range o.vs {
+			e.ws = append(e.ws, unitWeight)
+		}
+	}
+	e.vs = append(e.vs, o.vs...)
+	e.sorted = false
+}
+
+// sort sorts the values of e, and computes their cumulative weights if they
+// are weighted.
+func (e *exactQuantiler) sort() {
+	if e.sorted {
+		return
+	}
+	e.sorted = true
+	if e.ws == nil {
+		slices.SortFunc(e.vs, value.Cmp)
+		return
+	}
+	type pair struct {
+		v value
+		w *big.Rat
+	}
+	ps := make([]pair, len(e.vs))
+	for i, v := range e.vs {
+		ps[i] = pair{v, e.ws[i]}
+	}
+	slices.SortFunc(ps, func(a, b pair) int { return a.v.Cmp(b.v) })
+	e.cum = make([]*big.Rat, len(ps)+1)
+	e.cum[0] = new(big.Rat)
+	for i, p := range ps {
+		e.vs[i], e.ws[i] = p.v, p.w
+		e.cum[i+1] = new(big.Rat).Add(e.cum[i], p.w)
+	}
+}
+
+// Quantile returns the value at quantile q, interpolating linearly between
+// adjacent values when q does not fall exactly on an element.
+func (e *exactQuantiler) Quantile(q *big.Rat) *big.Rat {
+	if len(e.vs) == 0 {
+		return nil
+	}
+	e.sort()
+	if e.ws != nil {
+		return e.weightedQuantile(q)
+	}
+
+	// The position of q is q*(n-1), with integer part h and fraction f.
+	pos := new(big.Rat).Mul(q, big.NewRat(int64(len(e.vs)-1), 1))
+	h := new(big.Int).Quo(pos.Num(), pos.Denom()).Int64()
+	if h >= int64(len(e.vs)-1) {
+		return e.vs[len(e.vs)-1].Rat()
+	} else if h < 0 {
+		return e.vs[0].Rat()
+	}
+	f := pos.Sub(pos, big.NewRat(h, 1))
+
+	return lerp(e.vs[h], e.vs[h+1], f)
+}
+
+// weightedQuantile returns the value at quantile q of weighted values.
+//
+// A value with weight w whose predecessors have total weight C occupies the
+// positions from C + h to C + w - h, where h = min(w, 1)/2, so that a value
+// with integer weight k occupies the same positions as k unit-weight copies
+// of it would. The position of q is q*(W-1) + 1/2, where W is the total
+// weight, and positions between values are interpolated linearly.
+func (e *exactQuantiler) weightedQuantile(q *big.Rat) *big.Rat {
+	half := big.NewRat(1, 2)
+	lo := func(i int) *big.Rat { // the first position of vs[i]
+		h := new(big.Rat).Set(e.ws[i])
+		if h.Cmp(unitWeight) > 0 {
+			h.SetInt64(1)
+		}
+		return h.Add(e.cum[i], h.Mul(h, half))
+	}
+	hi := func(i int) *big.Rat { // the last position of vs[i]
+		h := new(big.Rat).Set(e.ws[i])
+		if h.Cmp(unitWeight) > 0 {
+			h.SetInt64(1)
+		}
+		return h.Sub(e.cum[i+1], h.Mul(h, half))
+	}
+
+	n := len(e.vs)
+	t := new(big.Rat).Sub(e.cum[n], unitWeight)
+	t.Mul(t, q).Add(t, half)
+	if t.Cmp(lo(0)) <= 0 {
+		return e.vs[0].Rat()
+	}
+
+	// Find the first value whose last position is at or after t.
+	i := sort.Search(n, func(i int) bool { return hi(i).Cmp(t) >= 0 })
+	if i == n {
+		return e.vs[n-1].Rat()
+	}
+	start := lo(i)
+	if start.Cmp(t) <= 0 {
+		return e.vs[i].Rat()
+	}
+
+	// Here t falls strictly between the last position of vs[i-1] and the
+	// first position of vs[i].
+	end := hi(i - 1)
+	f := new(big.Rat).Sub(t, end)
+	return lerp(e.vs[i-1], e.vs[i], f.Quo(f, start.Sub(start, end)))
+}
+
+// lerp returns lo + (hi-lo)*f. It is computed in float64 unless either value
+// is a rational or both are integers, so that the quantiles of integers are
+// exact.
+func lerp(lo, hi value, f *big.Rat) *big.Rat {
+	_, loInt := lo.Int64()
+	_, hiInt := hi.Int64()
+	if lo.r == nil && hi.r == nil && !(loInt && hiInt) {
+		ff, _ := f.Float64()
+		return ratFloat(lo.f + (hi.f-lo.f)*ff)
+	}
+	d := new(big.Rat).Sub(hi.Rat(), lo.Rat())
+	return d.Mul(d, f).Add(d, lo.Rat())
+}
+
+// digestQuantiler estimates quantiles using a t-digest.
+type digestQuantiler struct{ d *digest }
+
+func (q *digestQuantiler) Add(v value) { q.d.Add(v.Float(), 1) }
+
+func (q *digestQuantiler) AddWeighted(v, w value) { q.d.Add(v.Float(), w.Float()) }
+
+func (q *digestQuantiler) Merge(o quantiler) { q.d.Merge(o.(*digestQuantiler).d) }
+
+func (q *digestQuantiler) Quantile(r *big.Rat) *big.Rat {
+	if q.d.Count() == 0 {
+		return nil
+	}
+	f, _ := r.Float64()
+	return new(big.Rat).SetFloat64(q.d.Quantile(f))
+}
+
+// digestCompression is the compression parameter used for streaming quantile
+// estimates. Larger values give more accurate estimates at the cost of more
+// memory; the digest retains at most about 2× this many centroids.
+const digestCompression = 200
+
+// A digest is a merging t-digest, a sketch of a distribution that permits
+// accurate estimates of quantiles, especially near the tails, using bounded
+// memory. See https://arxiv.org/abs/1902.04023.
+type digest struct {
+	delta    float64
+	merged   []centroid // merged centroids, ordered by mean
+	buf      []centroid // unmerged values
+	total    float64    // total weight of all centroids
+	min, max float64
+}
+
+type centroid struct{ mean, weight float64 }
+
+func newDigest(delta float64) *digest {
+	return &digest{delta: delta, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// Count returns the total weight of values added to d.
+func (d *digest) Count() float64 { return d.total }
+
+// Add adds the value x with weight w to d.
+func (d *digest) Add(x, w float64) {
+	if math.IsNaN(x) || w <= 0 {
+		return
+	}
+	d.buf = append(d.buf, centroid{mean: x, weight: w})
+	d.total += w
+	d.min = min(d.min, x)
+	d.max = max(d.max, x)
+	if len(d.buf) >= 5*int(d.delta) {
+		d.compress()
+	}
+}
+
+// Merge adds the contents of o to d.
+func (d *digest) Merge(o *digest) {
+	for _, c := range o.merged {
+		d.Add(c.mean, c.weight)
+	}
+	for _, c := range o.buf {
+		d.Add(c.mean, c.weight)
+	}
+	d.min = min(d.min, o.min)
+	d.max = max(d.max, o.max)
+}
+
+// k is the scale function k₁ from the t-digest paper, which maps a quantile
+// to an index in the range [-δ/4, δ/4].
+func (d *digest) k(q float64) float64 {
+	return d.delta / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// kInv is the inverse of k.
+func (d *digest) kInv(k float64) float64 {
+	return (math.Sin(k*2*math.Pi/d.delta) + 1) / 2
+}
+
+// compress merges buffered values into the centroid list.
+func (d *digest) compress() {
+	if len(d.buf) == 0 {
+		return
+	}
+	all := append(d.merged, d.buf...)
+	slices.SortFunc(all, func(a, b centroid) int { return cmp.Compare(a.mean, b.mean) })
+
+	out := make([]centroid, 0, len(all))
+	var q0 float64
+	qLimit := d.kInv(d.k(q0) + 1)
+	cur := all[0]
+	for _, c := range all[1:] {
+		if q := q0 + (cur.weight+c.weight)/d.total; q <= qLimit {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		q0 += cur.weight / d.total
+		qLimit = d.kInv(d.k(q0) + 1)
+		out = append(out, cur)
+		cur = c
+	}
+	d.merged = append(out, cur)
+	d.buf = d.buf[:0]
+}
+
+// Quantile returns an estimate of the value at quantile q (0 ≤ q ≤ 1).
+// It returns NaN if d is empty.
+func (d *digest) Quantile(q float64) float64 {
+	d.compress()
+	if d.total == 0 {
+		return math.NaN()
+	} else if q <= 0 {
+		return d.min
+	} else if q >= 1 {
+		return d.max
+	}
+
+	// Each centroid is treated as a point located at the middle of the weight
+	// it spans, and the extrema anchor the ends. The target position is chosen
+	// so that when all centroids have unit weight, the result matches the
+	// exact interpolated quantile.
+	t := q*(d.total-1) + 0.5
+	prevPos, prevVal := 0.0, d.min
+	var cum float64
+	for _, c := range d.merged {
+		pos := cum + c.weight/2
+		if t < pos {
+			return interpolate(t, prevPos, prevVal, pos, c.mean)
+		}
+		prevPos, prevVal = pos, c.mean
+		cum += c.weight
+	}
+	return interpolate(t, prevPos, prevVal, d.total, d.max)
+}
+
+func interpolate(t, x0, y0, x1, y1 float64) float64 {
+	if x1 <= x0 {
+		return y1
+	}
+	return y0 + (y1-y0)*(t-x0)/(x1-x0)
+}
+
+// A percentile is a requested quantile and the label used to report it.
+type percentile struct {
+	label string
+	q     *big.Rat // 0 ≤ q ≤ 1
+}
+
+// parsePercentiles parses a comma-separated list of percentiles in the range
+// 0 to 100, e.g., "50,90,99.9".
+func parsePercentiles(s string) ([]percentile, error) {
+	var out []percentile
+	for p := range strings.SplitSeq(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		v, ok := new(big.Rat).SetString(p)
+		if !ok || v.Sign() < 0 || v.Cmp(big.NewRat(100, 1)) > 0 {
+			return nil, fmt.Errorf("invalid percentile %q", p)
+		}
+		out = append(out, percentile{label: "p" + p, q: v.Quo(v, big.NewRat(100, 1))})
+	}
+	return out, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestExactQuantile(t *testing.T) {
+	t.Run("Rat", func(t *testing.T) {
+		testExactQuantile(t, func(v int64) value { return ratValue(big.NewRat(v, 1)) }, 0)
+	})
+	t.Run("Float", func(t *testing.T) {
+		testExactQuantile(t, func(v int64) value { return floatValue(float64(v)) }, 1e-12)
+	})
+}
+
+func testExactQuantile(t *testing.T, newValue func(int64) value, tolerance float64) {
+	q := newQuantiler(true)
+	if got := q.Quantile(big.NewRat(1, 2)); got != nil {
+		t.Errorf("Empty quantile: got %v, want nil", got)
+	}
+	for _, v := range []int64{10, 4, 1, 3, 2} {
+		q.Add(newValue(v))
+	}
+	tests := []struct {
+		q    *big.Rat
+		want *big.Rat
+	}{
+		{big.NewRat(0, 1), big.NewRat(1, 1)},
+		{big.NewRat(1, 4), big.NewRat(2, 1)},
+		{big.NewRat(1, 2), big.NewRat(3, 1)},
+		{big.NewRat(9, 10), big.NewRat(38, 5)},
+		{big.NewRat(1, 1), big.NewRat(10, 1)},
+	}
+	for _, tc := range tests {
+		got := q.Quantile(tc.q)
+		diff, _ := new(big.Rat).Sub(got, tc.want).Float64()
+		if math.Abs(diff) > tolerance {
+			t.Errorf("Quantile(%v): got %v, want %v", tc.q, got.FloatString(6), tc.want.FloatString(6))
+		}
+	}
+}
+
+func TestStreamMatchesExact(t *testing.T) {
+	pcts, err := parsePercentiles("1,10,25,50,75,90,99,99.9")
+	if err != nil {
+		t.Fatalf("Parse percentiles: %v", err)
+	}
+
+	// For small inputs, the sketch retains every value and should agree with
+	// the exact computation.
+	t.Run("Small", func(t *testing.T) {
+		exact, stream := newQuantiler(true), newQuantiler(false)
+		for i := range 50 {
+			v := ratValue(big.NewRat(int64((i*37)%101), 4))
+			exact.Add(v)
+			stream.Add(v)
+		}
+		for _, p := range pcts {
+			want, _ := exact.Quantile(p.q).Float64()
+			got, _ := stream.Quantile(p.q).Float64()
+			if diff := got - want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Quantile %s: got %v, want %v", p.label, got, want)
+			}
+		}
+	})
+
+	// For large inputs, the sketch is approximate. Check that the rank of each
+	// estimate is close to the requested rank.
+	t.Run("Large", func(t *testing.T) {
+		const n = 200000
+		rng := rand.New(rand.NewPCG(1, 2))
+		exact, stream := newQuantiler(true), newQuantiler(false)
+		sorted := make([]float64, n)
+		for i := range n {
+			f := rng.ExpFloat64() * 100 // skewed, like latencies
+			sorted[i] = f
+			v := floatValue(f)
+			exact.Add(v)
+			stream.Add(v)
+		}
+		slices.Sort(sorted)
+
+		for _, p := range pcts {
+			q, _ := p.q.Float64()
+			got, _ := stream.Quantile(p.q).Float64()
+			want, _ := exact.Quantile(p.q).Float64()
+
+			rank, _ := slices.BinarySearch(sorted, got)
+			if err := float64(rank)/n - q; err > 0.005 || err < -0.005 {
+				t.Errorf("Quantile %s: got %v (rank %d), want %v (rank error %.4f)",
+					p.label, got, rank, want, err)
+			}
+		}
+	})
+}
+
+func TestParsePercentiles(t *testing.T) {
+	got, err := parsePercentiles("50, 90,99.9,")
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	var labels []string
+	for _, p := range got {
+		labels = append(labels, p.label)
+	}
+	if want := []string{"p50", "p90", "p99.9"}; !slices.Equal(labels, want) {
+		t.Errorf("Labels: got %q, want %q", labels, want)
+	}
+	if got[2].q.Cmp(big.NewRat(999, 1000)) != 0 {
+		t.Errorf("Quantile: got %v, want 999/1000", got[2].q)
+	}
+
+	for _, bad := range []string{"x", "-1", "101"} {
+		if got, err := parsePercentiles(bad); err == nil {
+			t.Errorf("Parse %q: got %v, want error", bad, got)
+		}
+	}
+}
+
+func TestWeightedQuantile(t *testing.T) {
+	// A value with integer weight k has the same quantiles as k copies of it.
+	for _, exact := range []bool{false, true} {
+		newValue := func(v int64) value {
+			if exact {
+				return ratValue(big.NewRat(v, 1))
+			}
+			return floatValue(float64(v))
+		}
+		weighted, repeated := new(exactQuantiler), new(exactQuantiler)
+		for i := range 40 {
+			v, k := newValue(int64((i*37)%23)), int64(i%3+1)
+			weighted.AddWeighted(v, newValue(k))
+			for range k {
+				repeated.Add(v)
+			}
+		}
+		for q := int64(0); q <= 20; q++ {
+			r := big.NewRat(q, 20)
+			got, want := weighted.Quantile(r), repeated.Quantile(r)
+			if diff, _ := new(big.Rat).Sub(got, want).Float64(); math.Abs(diff) > 1e-12 {
+				t.Errorf("Exact=%v: Quantile(%v): got %v, want %v", exact, r, got.FloatString(6), want.FloatString(6))
+			}
+		}
+	}
+
+	// Values with fractional weights interpolate between their positions.
+	q := newQuantiler(true)
+	q.AddWeighted(ratValue(big.NewRat(10, 1)), ratValue(big.NewRat(1, 2)))
+	q.AddWeighted(ratValue(big.NewRat(20, 1)), ratValue(big.NewRat(3, 1)))
+	q.Add(ratValue(big.NewRat(0, 1)))
+	tests := []struct {
+		q    *big.Rat
+		want *big.Rat
+	}{
+		// Positions: 0 at 1/2, 10 at 5/4, 20 from 2 to 4; t = q*7/2 + 1/2.
+		{big.NewRat(0, 1), big.NewRat(0, 1)},
+		{big.NewRat(1, 7), big.NewRat(20, 3)}, // t = 1
+		{big.NewRat(2, 7), big.NewRat(40, 3)}, // t = 3/2
+		{big.NewRat(1, 2), big.NewRat(20, 1)}, // t = 9/4
+		{big.NewRat(1, 1), big.NewRat(20, 1)},
+	}
+	for _, tc := range tests {
+		if got := q.Quantile(tc.q); got.Cmp(tc.want) != 0 {
+			t.Errorf("Quantile(%v): got %v, want %v", tc.q, got.RatString(), tc.want.RatString())
+		}
+	}
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/creachadair/misctools/stats/summary"
+)
+
+// collectOptions control which auxiliary data a collector maintains.
+type collectOptions struct {
+	exact     bool // use exact rational arithmetic rather than float64
+	quantiles bool // track quantiles
+	stream    bool // estimate quantiles rather than computing them exactly
+	retain    bool // retain all values, for histograms and rank tests
+	means     bool // track geometric and harmonic means
+	moments   bool // track the 3rd and 4th moments, for skewness and kurtosis
+	mode      bool // count distinct values to find the mode
+	xy        bool // collect pairs of values for correlation
+	count     bool // count occurrences of text values, instead of statistics
+	top       int  // with count and stream, the number of frequent values wanted
+}
+
+// A collector accumulates the statistics requested for a single column.
+// Summary statistics are accumulated exactly if the collector was created
+// with the exact option, or in float64 otherwise; in either case they are
+// reported as rationals. In float64 mode, they are also accumulated exactly
+// as long as all the values and weights are integers, and reported from
+// those instead. With the count option, a collector instead counts text
+// values, and reports only the numbers of values and distinct values.
+type collector struct {
+	exact bool
+	rat   summary.Stats // if exact
+	flt   summary.Float // if !exact
+	ints  *summary.Int  // if !exact, while all values are integers; else nil
+	qs    quantiler
+	hist  *histogram
+	means *positiveMeans
+	modes *modeCounter
+	freq  freqCounter
+}
+
+func newCollector(opts collectOptions) *collector {
+	c := &collector{exact: opts.exact}
+	if opts.exact && opts.moments {
+		c.rat.TrackHigherMoments() // float64 tracks them cheaply anyway
+	}
+	if opts.count {
+		c.freq = newFreqCounter(opts.stream, opts.top)
+		return c
+	}
+	if !opts.exact {
+		c.ints = new(summary.Int)
+		if opts.moments {
+			c.ints.TrackHigherMoments()
+		}
+	}
+	if opts.quantiles {
+		c.qs = newQuantiler(!opts.stream)
+	}
+	if opts.retain {
+		c.hist = new(histogram)
+	}
+	if opts.means {
+		c.means = new(positiveMeans)
+	}
+	if opts.mode {
+		c.modes = new(modeCounter)
+	}
+	return c
+}
+
+// Count returns the number of values added to c.
+func (c *collector) Count() int64 {
+	if c.freq != nil {
+		return c.freq.Total()
+	} else if c.exact {
+		return c.rat.Count()
+	}
+	return c.flt.Count()
+}
+
+// Weight returns the total weight of the values added to c.
+func (c *collector) Weight() *big.Rat {
+	if c.exact {
+		return c.rat.Weight()
+	} else if c.ints != nil {
+		return c.ints.Weight()
+	}
+	return ratFloat(c.flt.Weight())
+}
+
+// effectiveCount returns the effective number of values added to c, which is
+// the count if the values are unweighted, or nil if c is empty. This is used
+// in place of the count for statistics that depend on the sample size.
+func (c *collector) effectiveCount() *big.Rat {
+	if c.exact {
+		return c.rat.EffectiveCount()
+	} else if c.ints != nil {
+		return c.ints.EffectiveCount()
+	}
+	return ratFloat(c.flt.EffectiveCount())
+}
+
+// Sum returns the (weighted) sum of the values added to c.
+func (c *collector) Sum() *big.Rat {
+	if c.exact {
+		return c.rat.Sum()
+	} else if c.ints != nil {
+		return c.ints.Sum()
+	}
+	return ratFloat(c.flt.Sum())
+}
+
+// Min returns the minimum value added to c, or nil if c is empty.
+func (c *collector) Min() *big.Rat {
+	if c.exact {
+		return c.rat.Min()
+	} else if c.ints != nil {
+		return c.ints.Min()
+	}
+	return ratFloat(c.flt.Min())
+}
+
+// Max returns the maximum value added to c, or nil if c is empty.
+func (c *collector) Max() *big.Rat {
+	if c.exact {
+		return c.rat.Max()
+	} else if c.ints != nil {
+		return c.ints.Max()
+	}
+	return ratFloat(c.flt.Max())
+}
+
+// Mean returns the (weighted) mean of the values added to c, or nil if c is
+// empty.
+func (c *collector) Mean() *big.Rat {
+	if c.exact {
+		return c.rat.Mean()
+	} else if c.ints != nil {
+		return c.ints.Mean()
+	}
+	return ratFloat(c.flt.Mean())
+}
+
+// Var returns the sample variance of the values added to c, or nil if fewer
+// than two values have been added.
+func (c *collector) Var() *big.Rat {
+	if c.exact {
+		return c.rat.Var()
+	} else if c.ints != nil {
+		return c.ints.Var()
+	}
+	return ratFloat(c.flt.Var())
+}
+
+// Moment returns the kth central moment of the values added to c, for k from
+// 2 to 4, or nil if c is empty.
+func (c *collector) Moment(k int) *big.Rat {
+	if c.exact {
+		return c.rat.Moment(k)
+	} else if c.ints != nil {
+		return c.ints.Moment(k)
+	}
+	return ratFloat(c.flt.Moment(k))
+}
+
+// Add adds v to the statistics for c.
+func (c *collector) Add(v value) {
+	if c.exact {
+		c.rat.Add(v.Rat())
+	} else {
+		c.flt.Add(v.Float())
+		if n, ok := v.Int64(); ok && c.ints != nil {
+			c.ints.Add(n)
+		} else {
+			c.ints = nil
+		}
+	}
+	if c.qs != nil {
+		c.qs.Add(v)
+	}
+	if c.hist != nil {
+		c.hist.Add(v)
+	}
+	if c.means != nil {
+		c.means.Add(v.Float(), 1)
+	}
+	if c.modes != nil {
+		c.modes.Add(v, 1)
+	}
+}
+
+// AddWeighted adds v to the statistics for c with weight w, which must not be
+// negative. A value with zero weight is ignored.
+func (c *collector) AddWeighted(v, w value) {
+	if w.Sign() == 0 {
+		return
+	}
+	if c.exact {
+		c.rat.AddWeighted(v.Rat(), w.Rat())
+	} else {
+		c.flt.AddWeighted(v.Float(), w.Float())
+		n, ok := v.Int64()
+		k, wok := w.Int64()
+		if ok && wok && c.ints != nil {
+			c.ints.AddWeighted(n, k)
+		} else {
+			c.ints = nil
+		}
+	}
+	if c.qs != nil {
+		c.qs.AddWeighted(v, w)
+	}
+	if c.hist != nil {
+		c.hist.AddWeighted(v, w.Float())
+	}
+	if c.means != nil {
+		c.means.Add(v.Float(), w.Float())
+	}
+	if c.modes != nil {
+		c.modes.Add(v, w.Float())
+	}
+}
+
+// AddText adds an occurrence of the text value s to the counts for c, which
+// must have been created with the count option.
+func (c *collector) AddText(s string) { c.freq.Add(s) }
+
+// Merge adds the values collected by o to c. Both must have been created
+// with the same options.
+func (c *collector) Merge(o *collector) {
+	if c.freq != nil {
+		c.freq.Merge(o.freq)
+		return
+	}
+	c.rat.Merge(&o.rat)
+	c.flt.Merge(&o.flt)
+	if c.ints != nil && o.ints != nil {
+		c.ints.Merge(o.ints)
+	} else {
+		c.ints = nil
+	}
+	if c.qs != nil {
+		c.qs.Merge(o.qs)
+	}
+	if c.hist != nil {
+		c.hist.Merge(o.hist)
+	}
+	if c.means != nil {
+		c.means.Merge(o.means)
+	}
+	if c.modes != nil {
+		c.modes.Merge(o.modes)
+	}
+}
+
+// Values returns the values added to c, in no particular order. The collector
+// must have been created with the retain option.
+func (c *collector) Values() []value { return c.hist.vs }
+
+// Histogram partitions the values in c into buckets. If edges == nil, the
+// range of values is divided into n buckets, logarithmically spaced if log
+// is true.
+func (c *collector) Histogram(edges []*big.Rat, n int, log bool) ([]bucket, error) {
+	if edges == nil {
+		if log {
+			var err error
+			edges, err = logEdges(c.Min(), c.Max(), n)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			edges = linearEdges(c.Min(), c.Max(), n)
+		}
+	}
+	return c.hist.Buckets(edges), nil
+}
+
+// A result is a single named statistic.
+type result struct {
+	key, value string
+	num        *big.Rat // the numeric value, if any
+	approx     bool     // num is a float64 approximation of an irrational value
+}
+
+// Report returns the statistics selected by the command-line flags. Values
+// are formatted in the given units, except for the variance, whose units are
+// squared, and the dimensionless ratios (cv, skew, kurt), which are formatted
+// as plain numbers.
+func (c *collector) Report(pcts []percentile, unit unitKind) []result {
+	out := []result{{key: "n", value: strconv.FormatInt(c.Count(), 10), num: big.NewRat(c.Count(), 1)}}
+	add := func(key string, v *big.Rat, unit unitKind) {
+		out = append(out, result{key: key, value: unit.Format(v), num: v})
+	}
+	if c.freq != nil {
+		n, approx := c.freq.Distinct()
+		return append(out, result{key: "distinct", value: strconv.FormatInt(n, 10), num: big.NewRat(n, 1), approx: approx})
+	}
+	if *weightField != "" {
+		add("weight", c.Weight(), noUnit)
+	}
+	addFloat := func(key string, f float64, unit unitKind) {
+		v := ratFloat(f)
+		out = append(out, result{key: key, value: unit.Format(v), num: v, approx: true})
+	}
+	if *doSum {
+		add("sum", c.Sum(), unit)
+	}
+	if *doMin {
+		add("min", c.Min(), unit)
+	}
+	if *doMax {
+		add("max", c.Max(), unit)
+	}
+	if *doRange {
+		var r *big.Rat
+		if lo, hi := c.Min(), c.Max(); lo != nil {
+			r = hi.Sub(hi, lo)
+		}
+		add("range", r, unit)
+	}
+	if *doMean {
+		add("avg", c.Mean(), unit)
+	}
+	if *doGMean {
+		addFloat("gmean", c.means.Geometric(), unit)
+	}
+	if *doHMean {
+		addFloat("hmean", c.means.Harmonic(), unit)
+	}
+	if *doMode {
+		add("mode", c.modes.Mode(), unit)
+	}
+
+	// The variance and standard deviation are the sample estimates unless -pop
+	// is set. The standard error and confidence interval for the mean always
+	// use the sample standard deviation.
+	variance := c.Var()
+	if *doPop {
+		variance = c.Moment(2)
+	}
+	if *doVar {
+		add("var", variance, noUnit)
+	}
+	sdv := sqrtRat(variance)
+	if *doDev {
+		addFloat("sdv", sdv, unit)
+	}
+	neff := math.NaN()
+	if n := c.effectiveCount(); n != nil {
+		neff, _ = n.Float64()
+	}
+	sem := sqrtRat(c.Var()) / math.Sqrt(neff)
+	if *doSEM {
+		addFloat("sem", sem, unit)
+	}
+	if *ciLevel > 0 {
+		lo, hi := math.NaN(), math.NaN()
+		if neff > 1 {
+			mean, _ := c.Mean().Float64()
+			t := studentTQuantile(0.5+*ciLevel/200, neff-1)
+			lo, hi = mean-t*sem, mean+t*sem
+		}
+		label := "ci" + strconv.FormatFloat(*ciLevel, 'f', -1, 64)
+		addFloat(label+"_lo", lo, unit)
+		addFloat(label+"_hi", hi, unit)
+	}
+	if *doCV {
+		cv := math.NaN()
+		if m := c.Mean(); m != nil && m.Sign() != 0 {
+			mf, _ := m.Float64()
+			cv = sdv / mf
+		}
+		addFloat("cv", cv, noUnit)
+	}
+	if *doSkew {
+		addFloat("skew", c.skewness(*doPop), noUnit)
+	}
+	if *doKurt {
+		add("kurt", c.kurtosis(*doPop), noUnit)
+	}
+
+	if *doMed {
+		add("med", c.qs.Quantile(big.NewRat(1, 2)), unit)
+	}
+	if *doQuar {
+		for i := int64(1); i <= 3; i++ {
+			add(fmt.Sprintf("q%d", i), c.qs.Quantile(big.NewRat(i, 4)), unit)
+		}
+	}
+	for _, pct := range pcts {
+		add(pct.label, c.qs.Quantile(pct.q), unit)
+	}
+	return out
+}
+
+// statKeys returns the names of the statistics reported with opts and pcts,
+// in order.
+func statKeys(opts collectOptions, pcts []percentile) []string {
+	var rs []result
+	if opts.xy {
+		rs = new(pairCollector).Report()
+	} else {
+		rs = newCollector(opts).Report(pcts, noUnit)
+	}
+	keys := make([]string, len(rs))
+	for i, r := range rs {
+		keys[i] = r.key
+	}
+	return keys
+}
+
+// skewness returns the skewness of the values in c, or NaN if it is not
+// defined. If pop is false, it returns the adjusted Fisher-Pearson sample
+// skewness G₁; otherwise the population skewness g₁ = m₃/m₂^(3/2). For
+// weighted values, n is the effective count.
+func (c *collector) skewness(pop bool) float64 {
+	m2, m3 := c.Moment(2), c.Moment(3)
+	if m2 == nil || m2.Sign() == 0 || m3 == nil {
+		return math.NaN()
+	}
+	n, _ := c.effectiveCount().Float64()
+	if !pop && n <= 2 {
+		return math.NaN()
+	}
+	f2, _ := m2.Float64()
+	f3, _ := m3.Float64()
+	g1 := f3 / math.Pow(f2, 1.5)
+	if pop {
+		return g1
+	}
+	return g1 * math.Sqrt(n*(n-1)) / (n - 2)
+}
+
+// kurtosis returns the excess kurtosis of the values in c, or nil if it is
+// not defined. If pop is false, it returns the sample excess kurtosis
+// G₂ = (n-1)/((n-2)(n-3))·((n+1)·g₂ + 6); otherwise the population excess
+// kurtosis g₂ = m₄/m₂² - 3. Both are rational in the moments. For weighted
+// values, n is the effective count.
+func (c *collector) kurtosis(pop bool) *big.Rat {
+	m2, m4 := c.Moment(2), c.Moment(4)
+	if m2 == nil || m2.Sign() == 0 || m4 == nil {
+		return nil
+	}
+	n := c.effectiveCount()
+	if !pop && n.Cmp(big.NewRat(3, 1)) <= 0 {
+		return nil
+	}
+	g2 := new(big.Rat).Quo(m4, m2.Mul(m2, m2))
+	g2.Sub(g2, big.NewRat(3, 1))
+	if pop {
+		return g2
+	}
+	k := func(d int64) *big.Rat { return new(big.Rat).Add(n, big.NewRat(d, 1)) } // n + d
+	g2.Mul(g2, k(1)).Add(g2, big.NewRat(6, 1))
+	g2.Mul(g2, k(-1)).Quo(g2, k(-2))
+	return g2.Quo(g2, k(-3))
+}
+
+// sqrtRat returns the square root of r as a float64, or NaN if r is nil.
+func sqrtRat(r *big.Rat) float64 {
+	if r == nil {
+		return math.NaN()
+	}
+	f, _ := r.Float64()
+	return math.Sqrt(f)
+}
+
+// positiveMeans accumulates the logarithms and reciprocals of values, for
+// the geometric and harmonic means. These are computed in float64 and are
+// defined only if all values are positive.
+type positiveMeans struct {
+	logs, invs summary.Float
+	bad        int64 // number of values ≤ 0
+}
+
+func (p *positiveMeans) Add(f, w float64) {
+	if f <= 0 {
+		p.bad++
+		return
+	}
+	p.logs.AddWeighted(math.Log(f), w)
+	p.invs.AddWeighted(1/f, w)
+}
+
+func (p *positiveMeans) Merge(o *positiveMeans) {
+	p.logs.Merge(&o.logs)
+	p.invs.Merge(&o.invs)
+	p.bad += o.bad
+}
+
+// Geometric returns the geometric mean, or NaN if it is not defined.
+func (p *positiveMeans) Geometric() float64 {
+	if p.bad != 0 {
+		return math.NaN()
+	}
+	return math.Exp(p.logs.Mean())
+}
+
+// Harmonic returns the harmonic mean, or NaN if it is not defined.
+func (p *positiveMeans) Harmonic() float64 {
+	if p.bad != 0 {
+		return math.NaN()
+	}
+	return 1 / p.invs.Mean()
+}
+
+// A modeCounter totals the weights of each distinct value, to find the mode.
+// Exact and float64 values are counted separately.
+type modeCounter struct {
+	rats   map[string]float64 // exact values, by RatString
+	floats map[float64]float64
+}
+
+// Add adds w to the weight of v.
+func (m *modeCounter) Add(v value, w float64) {
+	if v.r != nil {
+		if m.rats == nil {
+			m.rats = make(map[string]float64)
+		}
+		m.rats[v.r.RatString()] += w
+	} else {
+		if m.floats == nil {
+			m.floats = make(map[float64]float64)
+		}
+		m.floats[v.f] += w
+	}
+}
+
+func (m *modeCounter) Merge(o *modeCounter) {
+	for k, n := range o.rats {
+		if m.rats == nil {
+			m.rats = make(map[string]float64)
+		}
+		m.rats[k] += n
+	}
+	for k, n := range o.floats {
+		if m.floats == nil {
+			m.floats = make(map[float64]float64)
+		}
+		m.floats[k] += n
+	}
+}
+
+// Mode returns the most frequent (or heaviest) value, or the least of several
+// equally frequent values, or nil if no values have been added.
+func (m *modeCounter) Mode() *big.Rat {
+	var best value
+	var most float64
+	consider := func(v value, n float64) {
+		if n > most || (n == most && v.Cmp(best) < 0) {
+			best, most = v, n
+		}
+	}
+	for k, n := range m.rats {
+		r, _ := new(big.Rat).SetString(k)
+		consider(ratValue(r), n)
+	}
+	for k, n := range m.floats {
+		consider(floatValue(k), n)
+	}
+	if most == 0 {
+		return nil
+	}
+	return best.Rat()
+}
+
+// ratFloat converts f to a rational, or returns nil if f is not finite.
+func ratFloat(f float64) *big.Rat {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil
+	}
+	return new(big.Rat).SetFloat64(f)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExtendedStats(t *testing.T) {
+	setFlags(t, "range", "true", "gmean", "true", "hmean", "true", "mode", "true",
+		"var", "true", "stdev", "true", "sem", "true", "ci", "95", "cv", "true",
+		"skew", "true", "kurt", "true")
+
+	// Reference values computed independently from the standard formulas.
+	input := []int64{2, 4, 4, 4, 5, 5, 7, 9}
+	sample := map[string]float64{
+		"n": 8, "range": 7, "gmean": 4.603215, "hmean": 4.201751, "mode": 4,
+		"var": 4.571429, "sdv": 2.138090, "sem": 0.755929,
+		"ci95_lo": 3.212512, "ci95_hi": 6.787488, "cv": 0.427618,
+		"skew": 0.818487, "kurt": 0.940625,
+	}
+	pop := map[string]float64{"var": 4, "sdv": 2, "cv": 0.4, "skew": 0.65625, "kurt": -0.21875}
+
+	for _, exact := range []bool{false, true} {
+		c := newCollector(collectOptions{exact: exact, means: true, moments: true, mode: true})
+		for _, v := range input {
+			if exact {
+				c.Add(ratValue(big.NewRat(v, 1)))
+			} else {
+				c.Add(floatValue(float64(v)))
+			}
+		}
+		check := func(want map[string]float64) {
+			t.Helper()
+			got := make(map[string]*big.Rat)
+			for _, r := range c.Report(nil, noUnit) {
+				got[r.key] = r.num
+			}
+			for key, w := range want {
+				if got[key] == nil {
+					t.Errorf("Exact=%v: %s: got nil, want %v", exact, key, w)
+				} else if g, _ := got[key].Float64(); math.Abs(g-w) > 1e-6 {
+					t.Errorf("Exact=%v: %s: got %.6f, want %.6f", exact, key, g, w)
+				}
+			}
+		}
+		check(sample)
+
+		setFlags(t, "pop", "true")
+		check(pop)
+		setFlags(t, "pop", "false")
+	}
+
+	// Statistics that are not defined for the input are reported as nil.
+	c := newCollector(collectOptions{means: true, mode: true})
+	c.Add(floatValue(-1))
+	for _, r := range c.Report(nil, noUnit) {
+		switch r.key {
+		case "n", "range", "mode":
+			if r.num == nil {
+				t.Errorf("Single value: %s: got nil, want a value", r.key)
+			}
+		default:
+			if r.num != nil {
+				t.Errorf("Single value: %s: got %v, want nil", r.key, r.num)
+			}
+		}
+	}
+}
+
+func TestWeightedStats(t *testing.T) {
+	setFlags(t, "weight", "2", "sum", "true", "mean", "true", "median", "true",
+		"gmean", "true", "mode", "true", "var", "true", "sem", "true")
+
+	// The input is equivalent to 2, 4, 4, 4, 5, 5, 7, 9 except for the
+	// variance, which is the reliability-weighted estimate M₂/(W - Σw²/W).
+	input := [][2]int64{{2, 1}, {4, 3}, {5, 2}, {7, 1}, {9, 1}, {100, 0}}
+	want := map[string]float64{
+		"n": 5, "weight": 8, "sum": 40, "avg": 5, "med": 4.5, "gmean": 4.603215,
+		"mode": 4, "var": 5.333333, "sem": 1.154701,
+	}
+	for _, exact := range []bool{false, true} {
+		c := newCollector(collectOptions{exact: exact, quantiles: true, means: true, mode: true})
+		for _, in := range input {
+			if exact {
+				c.AddWeighted(ratValue(big.NewRat(in[0], 1)), ratValue(big.NewRat(in[1], 1)))
+			} else {
+				c.AddWeighted(floatValue(float64(in[0])), floatValue(float64(in[1])))
+			}
+		}
+		got := make(map[string]*big.Rat)
+		for _, r := range c.Report(nil, noUnit) {
+			got[r.key] = r.num
+		}
+		for key, w := range want {
+			if got[key] == nil {
+				t.Errorf("Exact=%v: %s: got nil, want %v", exact, key, w)
+			} else if g, _ := got[key].Float64(); math.Abs(g-w) > 1e-6 {
+				t.Errorf("Exact=%v: %s: got %.6f, want %.6f", exact, key, g, w)
+			}
+		}
+	}
+}
+
+func TestIntegerExact(t *testing.T) {
+	setFlags(t, "sum", "true", "min", "true", "max", "true", "mean", "true", "var", "true", "median", "true")
+	report := func(in ...string) map[string]string {
+		t.Helper()
+		c := newCollector(collectOptions{quantiles: true})
+		for _, s := range in {
+			v, err := parseFloat(s)
+			if err != nil {
+				t.Fatalf("parseFloat(%q): %v", s, err)
+			}
+			c.Add(v)
+		}
+		got := make(map[string]string)
+		for _, r := range c.Report(nil, noUnit) {
+			got[r.key] = r.num.RatString()
+		}
+		return got
+	}
+
+	// Integers are summarized exactly without -exact, even beyond the range
+	// in which float64 is exact.
+	got := report("9007199254740993", "1", "1700000000123456789")
+	want := map[string]string{
+		"n": "3", "sum": "1709007199378197783", "min": "1", "max": "1700000000123456789",
+		"avg": "569669066459399261", "med": "9007199254740993",
+		"var": "958256297107998666536023683621389104",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Integers (-want, +got):\n%s", diff)
+	}
+
+	// Once a value is not an integer, the statistics are computed in float64,
+	// so that 9007199254740993 + 0.5 is rounded.
+	got = report("9007199254740993", "0.5")
+	if got["sum"] != "9007199254740992" {
+		t.Errorf("Mixed: got sum %s, want 9007199254740992", got["sum"])
+	}
+}
+
+func TestUndefinedText(t *testing.T) {
+	setFlags(t, "gmean", "true", "hmean", "true", "var", "true", "stdev", "true",
+		"sem", "true", "ci", "95", "skew", "true", "kurt", "true")
+
+	// Statistics that are not defined for the input print as "-", not "0".
+	tests := []struct {
+		name  string
+		input []int64
+		want  string // the undefined statistics
+	}{
+		{"NonPositive", []int64{-1, 0, 2, 5}, "gmean hmean"},
+		{"Constant", []int64{3, 3, 3, 3}, "skew kurt"},
+		{"Single", []int64{3}, "var sdv sem ci95_lo ci95_hi skew kurt"},
+	}
+	for _, tc := range tests {
+		for _, exact := range []bool{false, true} {
+			c := newCollector(collectOptions{exact: exact, means: true, moments: true})
+			for _, v := range tc.input {
+				if exact {
+					c.Add(ratValue(big.NewRat(v, 1)))
+				} else {
+					c.Add(floatValue(float64(v)))
+				}
+			}
+			var undef []string
+			for _, r := range c.Report(nil, noUnit) {
+				if r.value == "-" {
+					undef = append(undef, r.key)
+				} else if r.num == nil {
+					t.Errorf("%s exact=%v: %s is undefined but printed as %q", tc.name, exact, r.key, r.value)
+				}
+			}
+			if got := strings.Join(undef, " "); got != tc.want {
+				t.Errorf("%s exact=%v: undefined statistics: got %q, want %q", tc.name, exact, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestStatKeys(t *testing.T) {
+	setFlags(t, "mean", "true", "stdev", "true")
+	pcts, err := parsePercentiles("90")
+	if err != nil {
+		t.Fatalf("Parse percentiles: %v", err)
+	}
+	tests := []struct {
+		opts collectOptions
+		want string
+	}{
+		{collectOptions{quantiles: true}, "n avg sdv p90"},
+		{collectOptions{exact: true, quantiles: true, stream: true}, "n avg sdv p90"},
+		{collectOptions{count: true}, "n distinct"},
+		{collectOptions{xy: true}, "n cov pearson spearman slope intercept r2"},
+	}
+	for _, tc := range tests {
+		if got := strings.Join(statKeys(tc.opts, pcts), " "); got != tc.want {
+			t.Errorf("statKeys(%+v): got %q, want %q", tc.opts, got, tc.want)
+		}
+	}
+}
+
+func TestDataError(t *testing.T) {
+	setFlags(t, "hist", "true", "logscale", "true")
+	gs := newGroupSet(1, collectOptions{retain: true})
+	for _, v := range []float64{-1, 2} {
+		gs.Add(nil, []value{floatValue(v)})
+	}
+	fields := []column{{}}
+	rep := &reporter{pick: newPicker(fields, nil, noUnit, false), fields: fields}
+
+	// A report that cannot be made for the data is not an output error.
+	var derr dataError
+	if err := rep.write(new(bytes.Buffer), gs); !errors.As(err, &derr) {
+		t.Errorf("Write report: got %v, want a dataError", err)
+	}
+}
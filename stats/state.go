@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/creachadair/misctools/stats/summary"
+)
+
+// A saved state is the statistics gathered from the input, saved by
+// -save-state so that they can be combined with others by -merge-state. The
+// encoding is a gob-encoded stateHeader followed by a savedState. The header
+// identifies the version of the encoding, which must be changed whenever the
+// encoding of the state changes incompatibly.
+const (
+	stateMagic   = "stats-state"
+	stateVersion = 1
+)
+
+type stateHeader struct {
+	Magic   string
+	Version int
+}
+
+// savedState is the encoding of a set of groups and the settings needed to
+// report them. Fields are exported for gob.
+type savedState struct {
+	Options      savedOptions
+	Fields, Keys []savedColumn // as reported
+	Units        []unitKind    // for each field
+	Bucket       time.Duration // with -time, the width of the time buckets
+	Groups       []savedGroup
+}
+
+type savedOptions struct {
+	Exact, Quantiles, Stream, Retain, Means, Moments, Mode, XY, Count bool
+	Top                                                               int
+}
+
+type savedColumn struct {
+	Index int
+	Name  string
+}
+
+type savedGroup struct {
+	Key []string
+	Cs  []savedCollector
+	XY  *savedPairs
+}
+
+type savedCollector struct {
+	Rat   *summary.Stats
+	Float *summary.Float
+	Int   *summary.Int // with Float, if all values are integers
+
+	Quantiles savedValues
+	QWeights  []*big.Rat // with Quantiles, nil if unweighted
+	Digest    *savedDigest
+
+	Hist     savedValues
+	HWeights []float64 // with Hist, nil if unweighted
+
+	Logs, Invs *summary.Float // positive means
+	NonPos     int64          // number of values ≤ 0, for means
+
+	ModeRats   map[string]float64
+	ModeFloats map[float64]float64
+
+	Counts map[string]int64 // exact frequency counts
+	HLL    []uint8          // frequency sketch
+	Top    []savedFreq
+	Total  int64
+}
+
+// savedValues is the encoding of a list of values: rationals with -exact,
+// and otherwise float64, except for the integers kept exact (see parseFloat).
+type savedValues struct {
+	Rats   []string // as from RatString
+	Floats []float64
+	Ints   map[int]int64 // exact integers in Floats, by index
+}
+
+type savedDigest struct {
+	Delta, Total, Min, Max float64
+	Means, Weights         []float64
+}
+
+type savedFreq struct {
+	Value      string
+	Count, Err int64
+}
+
+type savedPairs struct {
+	N                     int64
+	MX, MY, SXX, SYY, SXY float64
+	XS, YS                []float64
+}
+
+// writeState writes the state of gs and the settings of rep to w.
+func writeState(w io.Writer, gs *groupSet, rep *reporter) error {
+	st := savedState{
+		Options: savedOptions{
+			Exact: gs.opts.exact, Quantiles: gs.opts.quantiles, Stream: gs.opts.stream,
+			Retain: gs.opts.retain, Means: gs.opts.means, Moments: gs.opts.moments, Mode: gs.opts.mode,
+			XY: gs.opts.xy, Count: gs.opts.count, Top: gs.opts.top,
+		},
+		Fields: saveColumns(rep.fields),
+		Keys:   saveColumns(rep.keys),
+		Units:  rep.pick.Units(),
+	}
+	if rep.pick.time != nil {
+		st.Bucket = rep.pick.time.width
+	}
+	for _, grp := range gs.groups {
+		sg := savedGroup{Key: grp.key}
+		for _, c := range grp.cs {
+			sg.Cs = append(sg.Cs, c.save())
+		}
+		if p := grp.xy; p != nil {
+			sg.XY = &savedPairs{N: p.n, MX: p.mx, MY: p.my, SXX: p.sxx, SYY: p.syy, SXY: p.sxy, XS: p.xs, YS: p.ys}
+		}
+		st.Groups = append(st.Groups, sg)
+	}
+	slices.SortFunc(st.Groups, func(a, b savedGroup) int { return slices.Compare(a.Key, b.Key) })
+
+	bw := bufio.NewWriter(w)
+	enc := gob.NewEncoder(bw)
+	if err := enc.Encode(stateHeader{Magic: stateMagic, Version: stateVersion}); err != nil {
+		return err
+	} else if err := enc.Encode(st); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// saveState writes the state of gs and the settings of rep to the file at
+// path, or to stdout if path is "-".
+func saveState(path string, gs *groupSet, rep *reporter) error {
+	if path == "-" {
+		return writeState(os.Stdout, gs, rep)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeState(f, gs, rep); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readState reads a state written by writeState from r. If reading r fails,
+// readState returns the *fs.PathError from the read, as distinct from the
+// contents of r not being a valid state.
+func readState(r io.Reader) (*savedState, error) {
+	dec := gob.NewDecoder(bufio.NewReader(r))
+	var h stateHeader
+	var perr *fs.PathError
+	if err := dec.Decode(&h); errors.As(err, &perr) {
+		return nil, perr
+	} else if err != nil || h.Magic != stateMagic {
+		return nil, errors.New("not a saved state")
+	} else if h.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported state version %d (want %d)", h.Version, stateVersion)
+	}
+	st := new(savedState)
+	if err := dec.Decode(st); errors.As(err, &perr) {
+		return nil, perr
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid state: %w", err)
+	}
+	return st, nil
+}
+
+// mergeStates reads the states saved in the files at paths, and returns
+// their combined groups, along with a reporter for them based on base. The
+// states must have been saved with the same fields and options, and those
+// options must provide the statistics requested by want. If a file cannot be
+// opened or read, the error wraps its *fs.PathError.
+func mergeStates(paths []string, base *reporter, want collectOptions) (*groupSet, *reporter, error) {
+	var gs *groupSet
+	var first *savedState
+	rep := *base
+	for _, path := range paths {
+		st, err := loadState(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts := st.Options.collectOptions()
+		if first == nil {
+			if err := checkOptions(opts, want); err != nil {
+				return nil, nil, fmt.Errorf("In %s: %w", path, err)
+			}
+			first, gs = st, newGroupSet(len(st.Fields), opts)
+			rep.fields, rep.keys = loadColumns(st.Fields), loadColumns(st.Keys)
+			rep.pick = newPicker(rep.fields, rep.keys, autoUnit, opts.exact)
+			for i, u := range st.Units {
+				if i < len(rep.pick.found) {
+					rep.pick.found[i].Store(int32(u))
+				}
+			}
+			rep.pick.count = opts.count
+			if st.Bucket > 0 {
+				// The layout is not used, but the labels of the buckets
+				// depend on their width.
+				rep.pick.time, err = newTimeBucketer(column{}, "RFC3339", st.Bucket)
+				if err != nil {
+					return nil, nil, fmt.Errorf("In %s: %w", path, err)
+				}
+			}
+		} else if opts != gs.opts || !slices.Equal(st.Fields, first.Fields) ||
+			!slices.Equal(st.Keys, first.Keys) || st.Bucket != first.Bucket {
+			return nil, nil, fmt.Errorf("In %s: state does not match %s", path, paths[0])
+		}
+		set := newGroupSet(len(st.Fields), opts)
+		for _, sg := range st.Groups {
+			if err := set.load(sg); err != nil {
+				return nil, nil, fmt.Errorf("In %s: %w", path, err)
+			}
+		}
+		gs.Merge(set)
+	}
+	return gs, &rep, nil
+}
+
+// loadState reads the state saved in the file at path. The special path "-"
+// denotes standard input.
+func loadState(path string) (*savedState, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	st, err := readState(r)
+	if err != nil {
+		return nil, fmt.Errorf("In %s: %w", path, err)
+	}
+	return st, nil
+}
+
+// checkOptions reports an error if a state collected with opts does not
+// provide the statistics requested with want.
+func checkOptions(opts, want collectOptions) error {
+	switch {
+	case opts.exact != want.exact:
+		return errors.New("state was saved with a different -exact setting")
+	case opts.xy != want.xy || opts.count != want.count:
+		return errors.New("state was saved with a different mode (-xy or -count)")
+	case want.quantiles && (!opts.quantiles || opts.stream != want.stream):
+		return errors.New("state does not include the requested percentiles")
+	case want.retain && !opts.retain,
+		want.means && !opts.means,
+		want.moments && !opts.moments,
+		want.mode && !opts.mode:
+		return errors.New("state does not include the requested statistics")
+	}
+	return nil
+}
+
+func (o savedOptions) collectOptions() collectOptions {
+	return collectOptions{
+		exact: o.Exact, quantiles: o.Quantiles, stream: o.Stream, retain: o.Retain,
+		means: o.Means, moments: o.Moments, mode: o.Mode, xy: o.XY, count: o.Count, top: o.Top,
+	}
+}
+
+func saveColumns(cs []column) []savedColumn {
+	out := make([]savedColumn, len(cs))
+	for i, c := range cs {
+		out[i] = savedColumn{Index: c.index, Name: c.name}
+	}
+	return out
+}
+
+func loadColumns(cs []savedColumn) []column {
+	out := make([]column, len(cs))
+	for i, c := range cs {
+		out[i] = column{index: c.Index, name: c.Name}
+	}
+	return out
+}
+
+// save returns the encoding of c.
+func (c *collector) save() savedCollector {
+	var sc savedCollector
+	if c.freq != nil {
+		switch f := c.freq.(type) {
+		case *exactCounter:
+			sc.Counts, sc.Total = f.counts, f.total
+		case *sketchCounter:
+			sc.HLL, sc.Total = f.hll.reg, f.total
+			for _, e := range f.top.heap {
+				sc.Top = append(sc.Top, savedFreq{Value: e.value, Count: e.count, Err: e.err})
+			}
+		}
+		return sc
+	}
+	if c.exact {
+		sc.Rat = &c.rat
+	} else {
+		sc.Float, sc.Int = &c.flt, c.ints
+	}
+	switch q := c.qs.(type) {
+	case *exactQuantiler:
+		sc.Quantiles, sc.QWeights = saveValues(q.vs, c.exact), q.ws
+	case *digestQuantiler:
+		d := q.d
+		d.compress()
+		sc.Digest = &savedDigest{Delta: d.delta, Total: d.total, Min: d.min, Max: d.max}
+		for _, c := range d.merged {
+			sc.Digest.Means = append(sc.Digest.Means, c.mean)
+			sc.Digest.Weights = append(sc.Digest.Weights, c.weight)
+		}
+	}
+	if c.hist != nil {
+		sc.Hist, sc.HWeights = saveValues(c.hist.vs, c.exact), c.hist.ws
+	}
+	if c.means != nil {
+		sc.Logs, sc.Invs, sc.NonPos = &c.means.logs, &c.means.invs, c.means.bad
+	}
+	if c.modes != nil {
+		sc.ModeRats, sc.ModeFloats = c.modes.rats, c.modes.floats
+	}
+	return sc
+}
+
+// load adds the group encoded by sg to g.
+func (g *groupSet) load(sg savedGroup) error {
+	grp := g.group(sg.Key)
+	if grp.xy != nil {
+		if sg.XY == nil {
+			return errors.New("missing pairs")
+		}
+		p := sg.XY
+		if len(p.XS) != len(p.YS) || int64(len(p.XS)) != p.N {
+			return errors.New("invalid pairs")
+		}
+		grp.xy = &pairCollector{n: p.N, mx: p.MX, my: p.MY, sxx: p.SXX, syy: p.SYY, sxy: p.SXY, xs: p.XS, ys: p.YS}
+		return nil
+	} else if len(sg.Cs) != len(grp.cs) {
+		return fmt.Errorf("group has %d fields, want %d", len(sg.Cs), len(grp.cs))
+	}
+	for i, sc := range sg.Cs {
+		if err := grp.cs[i].load(sc); err != nil {
+			return fmt.Errorf("group %q: %w", strings.Join(sg.Key, " "), err)
+		}
+	}
+	return nil
+}
+
+// load replaces the contents of c, a new collector, with the encoding sc. It
+// reports an error if the parts of sc are inconsistent, as they may be in a
+// corrupted state.
+func (c *collector) load(sc savedCollector) error {
+	switch f := c.freq.(type) {
+	case *exactCounter:
+		if sc.Counts != nil {
+			f.counts = sc.Counts
+		}
+		f.total = sc.Total
+		return nil
+	case *sketchCounter:
+		if len(sc.HLL) != len(f.hll.reg) {
+			return errors.New("invalid distinct count sketch")
+		}
+		f.hll.reg, f.total = sc.HLL, sc.Total
+		for _, s := range sc.Top {
+			e := &ssEntry{freq: freq{value: s.Value, count: s.Count, err: s.Err}}
+			f.top.index[s.Value] = e
+			heap.Push(&f.top.heap, e)
+		}
+		return nil
+	}
+
+	if c.exact && sc.Rat != nil {
+		c.rat = *sc.Rat
+	} else if !c.exact && sc.Float != nil {
+		c.flt, c.ints = *sc.Float, sc.Int
+	} else {
+		return errors.New("missing summary")
+	}
+	switch q := c.qs.(type) {
+	case *exactQuantiler:
+		vs, err := sc.Quantiles.values(c.exact)
+		if err != nil {
+			return err
+		} else if sc.QWeights != nil && len(sc.QWeights) != len(vs) {
+			return errors.New("invalid quantile weights")
+		}
+		for _, w := range sc.QWeights {
+			if w.Sign() < 0 {
+				return errors.New("invalid quantile weights")
+			}
+		}
+		q.vs, q.ws = vs, sc.QWeights
+	case *digestQuantiler:
+		if sc.Digest == nil {
+			return errors.New("missing quantile sketch")
+		}
+		sd := sc.Digest
+		if len(sd.Means) != len(sd.Weights) || slices.ContainsFunc(sd.Weights, func(w float64) bool { return !(w > 0) }) {
+			return errors.New("invalid quantile sketch")
+		}
+		q.d = &digest{delta: sd.Delta, total: sd.Total, min: sd.Min, max: sd.Max}
+		for i, m := range sd.Means {
+			q.d.merged = append(q.d.merged, centroid{mean: m, weight: sd.Weights[i]})
+		}
+	}
+	if c.hist != nil {
+		vs, err := sc.Hist.values(c.exact)
+		if err != nil {
+			return err
+		} else if sc.HWeights != nil && len(sc.HWeights) != len(vs) {
+			return errors.New("invalid histogram weights")
+		}
+		c.hist.vs, c.hist.ws = vs, sc.HWeights
+	}
+	if c.means != nil && sc.Logs != nil && sc.Invs != nil {
+		c.means.logs, c.means.invs, c.means.bad = *sc.Logs, *sc.Invs, sc.NonPos
+	}
+	if c.modes != nil {
+		c.modes.rats, c.modes.floats = sc.ModeRats, sc.ModeFloats
+	}
+	return nil
+}
+
+// saveValues returns the encoding of vs, whose values must all be rationals
+// if exact is true.
+func saveValues(vs []value, exact bool) savedValues {
+	var sv savedValues
+	for i, v := range vs {
+		if exact {
+			sv.Rats = append(sv.Rats, v.r.RatString())
+			continue
+		} else if v.r != nil {
+			if sv.Ints == nil {
+				sv.Ints = make(map[int]int64)
+			}
+			sv.Ints[i], _ = v.Int64()
+		}
+		sv.Floats = append(sv.Floats, v.Float())
+	}
+	return sv
+}
+
+// values returns the values encoded by sv, which must be rationals if exact
+// is true, or float64 otherwise.
+func (sv savedValues) values(exact bool) ([]value, error) {
+	if !exact {
+		out := make([]value, len(sv.Floats))
+		for i, f := range sv.Floats {
+			out[i] = floatValue(f)
+			if n, ok := sv.Ints[i]; ok {
+				out[i] = ratValue(big.NewRat(n, 1))
+			}
+		}
+		return out, nil
+	}
+	out := make([]value, len(sv.Rats))
+	for i, s := range sv.Rats {
+		r, err := parseValue(s)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = ratValue(r)
+	}
+	return out, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/misctools/stats/summary"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergeStates(t *testing.T) {
+	setFlags(t, "sum", "true", "var", "true", "median", "true", "gmean", "true",
+		"mode", "true", "pct", "90")
+	fields, keys := []column{{index: 2}}, []column{{index: 1}}
+
+	tests := []struct {
+		name string
+		opts collectOptions
+	}{
+		{"Float", collectOptions{quantiles: true, retain: true, means: true, mode: true}},
+		{"Exact", collectOptions{exact: true, quantiles: true, retain: true, means: true, mode: true}},
+		{"Stream", collectOptions{quantiles: true, stream: true, means: true, mode: true}},
+		{"Count", collectOptions{count: true}},
+		{"CountStream", collectOptions{count: true, stream: true, top: 10}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Save the values in three shards, and compare the merged state
+			// with the values gathered all together.
+			dir := t.TempDir()
+			all := newGroupSet(1, tc.opts)
+			var paths []string
+			for shard := range 3 {
+				gs := newGroupSet(1, tc.opts)
+				for i := shard; i < 60; i += 3 {
+					key := []string{fmt.Sprint("k", i%2)}
+					v := big.NewRat(int64(i*i%17+1), 4)
+					for _, set := range []*groupSet{gs, all} {
+						if tc.opts.count {
+							set.AddText(key, v.RatString())
+						} else if tc.opts.exact {
+							set.AddWeighted(key, []value{ratValue(v)}, ratValue(big.NewRat(int64(i%3+1), 1)))
+						} else {
+							set.Add(key, []value{floatValue(ratValue(v).Float())})
+						}
+					}
+				}
+				rep := &reporter{pick: newPicker(fields, keys, noUnit, tc.opts.exact), fields: fields, keys: keys}
+				path := filepath.Join(dir, fmt.Sprint(shard))
+				if err := saveState(path, gs, rep); err != nil {
+					t.Fatalf("Save state: %v", err)
+				}
+				paths = append(paths, path)
+			}
+
+			base := &reporter{pick: newPicker(nil, nil, noUnit, false)}
+			merged, rep, err := mergeStates(paths, base, tc.opts)
+			if err != nil {
+				t.Fatalf("Merge states: %v", err)
+			}
+			if diff := cmp.Diff(keys, rep.keys, cmp.AllowUnexported(column{})); diff != "" {
+				t.Errorf("Merged keys (-want, +got):\n%s", diff)
+			}
+			var want, got bytes.Buffer
+			if err := rep.write(&want, all); err != nil {
+				t.Fatalf("Write report: %v", err)
+			}
+			if err := rep.write(&got, merged); err != nil {
+				t.Fatalf("Write merged report: %v", err)
+			}
+			if diff := cmp.Diff(want.String(), got.String()); diff != "" {
+				t.Errorf("Merged report (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStateErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, f func(*gob.Encoder)) string {
+		var buf bytes.Buffer
+		f(gob.NewEncoder(&buf))
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	text := filepath.Join(dir, "text")
+	os.WriteFile(text, []byte("1\n2\n3\n"), 0600)
+	future := write("future", func(e *gob.Encoder) {
+		e.Encode(stateHeader{Magic: stateMagic, Version: stateVersion + 1})
+	})
+
+	exact := newGroupSet(1, collectOptions{exact: true})
+	exact.Add(nil, []value{ratValue(big.NewRat(1, 1))})
+	saved := filepath.Join(dir, "exact")
+	if err := saveState(saved, exact, &reporter{pick: newPicker([]column{{}}, nil, noUnit, true), fields: []column{{}}}); err != nil {
+		t.Fatalf("Save state: %v", err)
+	}
+
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{text}, "not a saved state"},
+		{[]string{future}, "unsupported state version"},
+		{[]string{saved}, "different -exact setting"},
+	}
+	base := &reporter{pick: newPicker(nil, nil, noUnit, false)}
+	for _, tc := range tests {
+		_, _, err := mergeStates(tc.paths, base, collectOptions{})
+		var perr *fs.PathError
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("mergeStates(%q): got %v, want %q", tc.paths, err, tc.want)
+		} else if errors.As(err, &perr) {
+			t.Errorf("mergeStates(%q): got read error %v, want invalid state", tc.paths, err)
+		}
+	}
+
+	// Inconsistent parts of a corrupted state are reported, rather than
+	// causing a panic later.
+	corrupt := func(name string, opts savedOptions, sg savedGroup) string {
+		return write(name, func(e *gob.Encoder) {
+			e.Encode(stateHeader{Magic: stateMagic, Version: stateVersion})
+			e.Encode(savedState{Options: opts, Fields: []savedColumn{{}}, Groups: []savedGroup{sg}})
+		})
+	}
+	one := new(summary.Float)
+	one.Add(1)
+	for _, tc := range []struct {
+		path string
+		xy   bool
+		want string
+	}{
+		{corrupt("digest", savedOptions{Quantiles: true, Stream: true}, savedGroup{Cs: []savedCollector{{
+			Float: one, Digest: &savedDigest{Means: []float64{1, 2}, Weights: []float64{1}},
+		}}}), false, "invalid quantile sketch"},
+		{corrupt("qweights", savedOptions{Quantiles: true}, savedGroup{Cs: []savedCollector{{
+			Float: one, Quantiles: savedValues{Floats: []float64{1, 2}}, QWeights: []*big.Rat{big.NewRat(1, 1)},
+		}}}), false, "invalid quantile weights"},
+		{corrupt("hweights", savedOptions{Retain: true}, savedGroup{Cs: []savedCollector{{
+			Float: one, Hist: savedValues{Floats: []float64{1}}, HWeights: []float64{1, 1},
+		}}}), false, "invalid histogram weights"},
+		{corrupt("pairs", savedOptions{XY: true}, savedGroup{XY: &savedPairs{N: 2, XS: []float64{1, 2}, YS: []float64{1}}}),
+			true, "invalid pairs"},
+	} {
+		_, _, err := mergeStates([]string{tc.path}, base, collectOptions{xy: tc.xy})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("mergeStates(%q): got %v, want %q", tc.path, err, tc.want)
+		}
+	}
+	// A file that cannot be read is reported as such, not as an invalid state.
+	for _, path := range []string{filepath.Join(dir, "missing"), dir} {
+		_, _, err := mergeStates([]string{path}, base, collectOptions{})
+		var perr *fs.PathError
+		if !errors.As(err, &perr) {
+			t.Errorf("mergeStates(%q): got %v, want a *fs.PathError", path, err)
+		}
+	}
+}
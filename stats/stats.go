@@ -4,15 +4,23 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"io/fs"
 	"log"
-	"math"
 	"math/big"
 	"os"
+	"os/signal"
 	"regexp"
+	"runtime"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/creachadair/taskgroup"
 )
 
 var (
@@ -23,11 +31,62 @@ var (
 	doMean = flag.Bool("mean", false, "Print arithmetic mean")
 	doVar  = flag.Bool("var", false, "Print sample variance")
 	doDev  = flag.Bool("stdev", false, "Print sample standard deviation")
+	doMed  = flag.Bool("median", false, "Print median entry")
+	doQuar = flag.Bool("quartiles", false, "Print quartiles")
 	doTrim = flag.Bool("trim", false, "Trim leading and trailing whitespace")
 
-	splitter  = flag.String("split", "", `Split input lines on this regexp ("" means don't split)`)
-	field     = flag.Int("field", 0, "Field to select (1-based; use 0 for the entire line)")
-	precision = flag.Int("prec", 1, "Number of digits of precision for fractional values")
+	doRange = flag.Bool("range", false, "Print range (max - min)")
+	doGMean = flag.Bool("gmean", false, "Print geometric mean")
+	doHMean = flag.Bool("hmean", false, "Print harmonic mean")
+	doMode  = flag.Bool("mode", false, "Print most frequent entry")
+	doSEM   = flag.Bool("sem", false, "Print standard error of the mean")
+	ciLevel = flag.Float64("ci", 0, "Print a confidence interval for the mean at this level (e.g., 95)")
+	doCV    = flag.Bool("cv", false, "Print coefficient of variation (stdev / mean)")
+	doSkew  = flag.Bool("skew", false, "Print skewness")
+	doKurt  = flag.Bool("kurt", false, "Print excess kurtosis")
+	doPop   = flag.Bool("pop", false, "Use population rather than sample variance, stdev, skewness, and kurtosis")
+
+	splitter     = flag.String("split", "", `Split input lines on this regexp ("" means don't split)`)
+	inFormat     = flag.String("format", "text", "Input format (text, csv, tsv, jsonl)")
+	useHeader    = flag.Bool("header", true, "Treat the first record of each csv or tsv file as a header")
+	fieldList    = flag.String("field", "0", "Fields to select, e.g., 2,4-6 or names (1-based; use 0 for the entire line)")
+	exprSpec     = flag.String("expr", "", `Select the value of this expression over fields (e.g., "$3 / $2"), instead of -field`)
+	weightField  = flag.String("weight", "", "Weight each value by the number in this field")
+	xyFields     = flag.String("xy", "", "Report correlation and regression of the second of these two fields on the first")
+	groupBy      = flag.String("by", "", "Group lines by these comma-separated key fields (1-based or names)")
+	sortBy       = flag.String("sort", "key", `Order groups by "key" or by this statistic (e.g., avg), decreasing`)
+	topK         = flag.Int("top", 0, "Print only this many groups (0 means all)")
+	timeField    = flag.String("time", "", "Group lines into time buckets by the timestamp in this field")
+	timeLayout   = flag.String("layout", "RFC3339", "Layout of -time timestamps (a Go layout or its name, or unix, unixms, unixus, unixns)")
+	bucketWidth  = flag.Duration("bucket", time.Minute, "Width of -time buckets")
+	doCompare    = flag.Bool("compare", false, "Compare the values in two input files")
+	doCount      = flag.Bool("count", false, "Count the occurrences of each distinct value of the selected field")
+	countValues  = flag.Int("values", 0, "With -count, list only this many of the most frequent values of each group (0 means all)")
+	doBench      = flag.Bool("bench", false, "Summarize each metric of each benchmark in Go benchmark output")
+	saveFile     = flag.String("save-state", "", `Save the statistics to this file ("-" for stdout) for -merge-state, instead of printing them`)
+	mergeFiles   = flag.Bool("merge-state", false, "Combine the statistics saved by -save-state in the input files")
+	doFollow     = flag.Bool("follow", false, "Follow growing input files, printing statistics periodically")
+	interval     = flag.Duration("every", 10*time.Second, "With -follow, print statistics at this interval")
+	windowSpec   = flag.String("window", "", "Compute statistics over the last N values or a duration (e.g., 1000 or 5m)")
+	outFormat    = flag.String("o", "text", "Output format (text, json, csv, tsv)")
+	unitMode     = flag.String("units", "none", "Parse values with units (none, duration, bytes, percent, auto)")
+	precision    = flag.Int("prec", 1, "Number of digits of precision for fractional values")
+	exactMath    = flag.Bool("exact", false, "Use exact rational arithmetic rather than float64")
+	strictMode   = flag.Bool("strict", false, "Exit on the first invalid input record")
+	maxErrors    = flag.Int("max-errors", 0, "Exit after more than this many invalid input records (0 means no limit)")
+	rejectFile   = flag.String("rejects", "", "Write invalid input records to this file, prefixed by file and line")
+	outlierBy    = flag.String("outliers", "", "Report outlying values found by this method (iqr, zscore, mad)")
+	threshold    = flag.Float64("threshold", 0, "Threshold for -outliers (0 means the default for the method)")
+	dropOutliers = flag.Bool("drop-outliers", false, "Exclude records with outlying values from the statistics")
+	outlierMark  = flag.String("mark", "", "With -cat and -outliers, prefix outlying records with this marker")
+	pctList      = flag.String("pct", "", "Print these comma-separated percentiles (e.g., 50,90,99)")
+	doStream     = flag.Bool("stream", false, "Estimate percentiles in bounded memory rather than exactly")
+	doHist       = flag.Bool("hist", false, "Print a histogram of entries")
+	nBuckets     = flag.Int("buckets", 10, "Number of histogram buckets")
+	edgeList     = flag.String("edges", "", "Comma-separated histogram bucket edges (overrides -buckets)")
+	logScale     = flag.Bool("logscale", false, "Use logarithmically-spaced histogram buckets")
+	doSpark      = flag.Bool("spark", false, "Print a sparkline of the values in input order")
+	doPlot       = flag.Bool("plot", false, "Plot a chart of the values in input order")
 )
 
 func init() {
@@ -37,100 +96,189 @@ func init() {
 Print basic statistics on a column of values read from the given input files.
 If no files are specified, input is read from stdin.  Files are read in the
 order specified; use the special name "-" to read from stdin explicitly.
+Multiple files are read concurrently, except when -cat is set.
 
-Options:`)
-		flag.PrintDefaults()
-	}
-}
+With -split, each line is split into fields and -field selects which to use.
+If -field names more than one field, separate statistics are computed for each
+and the results are printed as a table with one row per field. The statistics
+for each field are the same as if it were selected by itself: if some of the
+fields of a record are invalid, the record is counted as invalid, but the
+values of its other fields are used.
 
-type stats struct {
-	sum      big.Rat
-	sda, sdq big.Rat
-	min, max *big.Rat
-	count    int64
-}
+With -by, lines are partitioned into groups by the values of the given key
+fields, and statistics are computed separately for each group. Groups are
+printed as a table ordered by key, or by decreasing value of a reported
+statistic given by -sort. Use -top to print only the first groups in order.
 
-// Sum returns the sum of all elements passed to s.Add so far.
-func (s *stats) Sum() *big.Rat { return &s.sum }
+With -time, lines are instead grouped into time buckets of the width given by
+-bucket, by the timestamp in the given field, parsed according to -layout. The
+layout is a Go time layout (e.g., "2006-01-02 15:04:05"), the name of a
+standard layout defined by the Go time package (e.g., RFC3339 or DateTime), or
+unix, unixms, unixus, or unixns for Unix time in seconds, milliseconds,
+microseconds, or nanoseconds. Each bucket is labelled by its start time in UTC.
+Buckets with no values between the first and last are printed as empty rows.
 
-// Min returns the minimum element seen so far, or nil.
-func (s *stats) Min() *big.Rat { return s.min }
+By default input is read as lines of text. Use -format to read CSV or TSV
+records, in which fields may be selected by position or by the name of a
+column in the header, or JSON Lines, in which fields are selected by a path
+of object keys and array indices, e.g., ".timing.total_ms" or ".items.0.size".
+Input compressed with gzip, bzip2, or zlib is decompressed automatically,
+including standard input; the format is detected from the data, not the name.
 
-// Max returns the maximum element seen so far, or nil.
-func (s *stats) Max() *big.Rat { return s.max }
+With -expr, the value selected from each record is the value of an arithmetic
+expression over its fields, instead of a single field. Fields are written $N
+for field N (with $0 for the entire record), or ${NAME} for a named field, and
+may be combined with numbers, the operators + - * /, parentheses, and the
+functions abs, min, max, and log (the natural logarithm). For example:
 
-// Mean returns the arithmetic mean of the statistics gathered so far.
-// Returns nil if no values have been gathered.
-func (s *stats) Mean() *big.Rat {
-	if s.count == 0 {
-		return nil
-	}
-	c := big.NewRat(1, s.count)
-	return c.Mul(c, &s.sum)
-}
+  stats -split ' ' -expr '$3 / $2 * 1000'
 
-// Var returns the sample variacne of the statistics gathered so far.
-func (s *stats) Var() *big.Rat {
-	return new(big.Rat).Mul(&s.sdq, big.NewRat(1, s.count-1))
-}
+The expression is evaluated with exact rational arithmetic. A record for which
+it cannot be evaluated, for example due to division by zero, is invalid.
 
-// Count returns the number of elements seen so far.
-func (s *stats) Count() int64 { return s.count }
+With -count, the selected field is treated as text rather than a number, and
+the number of values (n) and of distinct values (distinct) are reported,
+followed by a table of the most frequent values with their counts and
+percentages, in decreasing order of count. Use -values to list only that many
+values for each group (and -top, as usual, to print only that many groups).
+By default every distinct value is retained in memory. With -stream, the
+number of distinct values is instead estimated with a HyperLogLog sketch
+(within about 1%), and the most frequent values are found with a Space-Saving
+sketch, which lists 10 values unless -values is set; the count of each may be
+too high by at most the amount given as err.
 
-// Add adds the value denoted by s to the sum and updates min/max as needed.
-func (s *stats) Add(v *big.Rat) {
-	s.sum.Add(&s.sum, v)
-	s.count++
-	if s.min == nil || v.Cmp(s.min) == -1 {
-		s.min = v
-	}
-	if s.max == nil || v.Cmp(s.max) == 1 {
-		s.max = v
-	}
-	sdaNext := new(big.Rat)
-	tmp := new(big.Rat)
-	sdaNext.Add(&s.sda, tmp.Sub(v, &s.sda).Mul(tmp, big.NewRat(1, s.count)))
+With -bench, the input is read as the output of Go benchmarks ("go test
+-bench"), and every metric reported by each benchmark (ns/op, B/op, allocs/op,
+and any custom metrics) is summarized separately. Benchmarks are identified by
+name without the GOMAXPROCS suffix (e.g., "-8"). Lines that are not benchmark
+results are ignored. With -compare, the results of two benchmark runs are
+compared for each benchmark and metric.
 
-	sdqNext := new(big.Rat)
-	tmp2 := new(big.Rat)
-	sdqNext.Add(&s.sdq, tmp.Sub(v, &s.sda).Mul(tmp, tmp2.Sub(v, sdaNext)))
-	s.sda.Set(sdaNext)
-	s.sdq.Set(sdqNext)
-}
+With -weight, each value counts in proportion to the weight given by another
+field of its record, which must be a non-negative number; values with weight 0
+are ignored. The weights apply to the sum, the means, variance, percentiles,
+mode, and histograms, and the total weight is reported as "weight". For the
+sum, means, and percentiles, a value with weight 2 counts as if it occurred
+twice. The variance is the unbiased estimate for reliability weights, and
+statistics that depend on the sample size, such as -sem and -ci, use the
+effective sample size (Σw)²/Σw².
 
-func newPicker(re string, n int) *picker {
-	if re == "" {
-		return &picker{field: n}
-	}
-	return &picker{regexp.MustCompile(re), n}
-}
+Percentiles (-median, -quartiles, -pct) are computed exactly by default, which
+requires retaining all the input values in memory. With -stream, they are
+instead estimated from a fixed-size sketch, suitable for very large inputs.
 
-type picker struct {
-	*regexp.Regexp
-	field int
-}
+With -hist, a histogram is printed after the summary. By default the range of
+values is divided into -buckets equal intervals, or logarithmic intervals with
+-logscale. Use -edges to give explicit bucket boundaries. The width of the bars
+is scaled to fit the terminal, whose width may be overridden by the COLUMNS
+environment variable.
 
-// Pick returns the value selected by the current settings from s.
-func (p picker) Pick(s string) (*big.Rat, error) {
-	var field string
-	if p.Regexp == nil || p.field <= 0 {
-		field = strings.TrimSpace(s)
-	} else if fields := p.Split(s, -1); len(fields) < p.field {
-		return nil, fmt.Errorf("field %d out of range (%d found)", p.field, len(fields))
-	} else {
-		field = fields[p.field-1]
-	}
+With -spark, a sparkline of the values in the order they were read is printed
+after the summary, and with -plot, a line chart of them, labelled with the
+least and greatest values. With -time, these show the mean of each time bucket
+instead, with gaps for empty buckets. The values are averaged in runs as
+needed to fit the width of the terminal.
+
+With -units, values may have units, and results are printed in the largest
+unit in which they are at least 1. Durations use Go syntax, such as "320ms",
+"1.5s", or "1h2m". Byte sizes accept SI (kB, MB) and IEC (KiB, MiB) suffixes;
+a bare prefix letter (K, M, G) is a power of 1024, as printed by du -h.
+Percentages have a trailing "%". Unit-less values are taken to be in seconds,
+bytes, or percent, respectively, and numbers may contain grouping commas,
+as in "1,234,567". With -units auto, the kind of unit is detected separately
+for each field.
+
+With -follow, input files are read continuously as they grow, like tail -F,
+and statistics are printed every interval given by -every until the program
+is interrupted. Following survives truncation and replacement (rotation) of
+the input files. Use -window to compute statistics over only the most recent
+values, either a number of values (-window 1000) or the values received within
+a duration (-window 5m). Without -window, statistics cover all values read.
+
+Further statistics include the -range, the geometric and harmonic means (-gmean
+and -hmean, defined only if all values are positive), the most frequent value
+(-mode, which retains each distinct value in memory), the standard error of the
+mean (-sem), a Student's t confidence interval for the mean (-ci 95), the
+coefficient of variation (-cv), skewness (-skew), and excess kurtosis (-kurt).
+By default the variance, standard deviation, skewness, and kurtosis are sample
+estimates; with -pop, they are computed for the input as a whole population.
+
+With -xy X,Y, two fields are selected from each line instead of -field, and
+the statistics reported are the covariance, the Pearson and Spearman rank
+correlation coefficients, and the slope, intercept, and R² of the least-squares
+regression of Y on X. These are computed in float64, and the values are
+retained in memory for the rank correlation. The covariance is the sample
+covariance unless -pop is set.
+
+With -compare, exactly two input files are read, for example benchmark results
+before and after a change. The statistics for each file are printed side by side
+as a table with a "file" column, followed by a comparison of each group and
+field: the difference (delta) and relative change of the means, Welch's t-test
+for the difference of the means, and the Mann-Whitney U test for a difference
+in distribution, with two-sided p-values. The Mann-Whitney p-value uses the
+normal approximation, which is less accurate for very small samples.
+
+By default values are parsed and accumulated as 64-bit floating-point numbers,
+using compensated summation and Welford's method for the variance to limit
+rounding error. As long as every value (and weight) of a field is an integer
+that fits in 64 bits, such as a byte count or a timestamp in nanoseconds, its
+statistics are instead computed exactly. With -exact, values are parsed and
+accumulated as exact rationals, which is much slower but free of rounding
+error for any input.
+
+With -save-state FILE, the statistics gathered from the input are saved to the
+file instead of being printed, and with -merge-state, the input files are
+instead states saved by -save-state, which are combined and reported as if
+their inputs had been read together. This allows statistics to be computed
+separately for shards of the input, for example on different machines, and
+merged without moving the input. The states must have been saved with the
+same fields, -by keys, and -time buckets, and with the flags needed for the
+statistics requested when merging, such as -median, -hist, or -exact. The
+merged state may itself be saved with -save-state. The encoding of the state
+is versioned, and states saved by an incompatible version are rejected.
+
+With -outliers, values are checked for outliers separately in each group and
+field, by one of these methods, where k is given by -threshold:
+
+  iqr     more than k times the interquartile range outside the quartiles
+          (default k = 1.5)
+  zscore  more than k standard deviations from the mean (default k = 3)
+  mad     modified z-score, based on the median absolute deviation, greater
+          than k (default k = 3.5)
+
+The outliers are listed after the statistics, with their file and line. With
+-drop-outliers, records with an outlying value are instead excluded from the
+statistics. With -cat, records with outlying values are prefixed by -mark, or
+omitted if -drop-outliers is set. Finding outliers requires retaining all the
+values in memory.
+
+Input records that cannot be parsed, or lack the selected fields, are logged
+and skipped, and the number skipped in each file is reported after the
+statistics. Use -strict to exit at the first invalid record instead, or
+-max-errors to exit once more than that many have been found. With -rejects,
+the invalid records are also written to a file, each prefixed by "file:line: ".
+The exit status is 1 for invalid arguments, 3 if there were too many invalid
+input records or the input cannot be reported as requested (for example, a
+-logscale histogram of values that are not all positive), and 4 if an input
+could not be read or the output could not be written. If an input cannot be
+read, the statistics for the other inputs are still reported.
+
+By default results are printed as text, with fractional values printed to the
+number of digits given by -prec. Statistics that are not defined for the input,
+such as the variance of a single value, are printed as "-". Use -o to print
+results as JSON Lines, CSV, or TSV records instead. Structured records contain
+the group key (if any), the selected field, and each reported statistic in base
+units, as a decimal string with full float64 precision, or with -exact as an
+exact rational string (e.g., "7/3") where the value is rational.
 
-	v, ok := big.NewRat(0, 1).SetString(field)
-	if ok {
-		return v, nil
+Options:`)
+		flag.PrintDefaults()
 	}
-	return nil, fmt.Errorf("invalid number format for %q", field)
 }
 
 func ratString(r *big.Rat) string {
 	if r == nil {
-		return "0"
+		return "-" // undefined; not "0", which looks like a value
 	} else if r.IsInt() || *precision <= 0 {
 		return r.RatString()
 	}
@@ -147,87 +295,376 @@ func trim(s string) string {
 func main() {
 	flag.Parse()
 
-	p := newPicker(*splitter, *field)
-	s := new(stats)
+	switch *inFormat {
+	case "", "text", "csv", "tsv", "jsonl":
+	default:
+		fail("Invalid -format: unknown input format %q", *inFormat)
+	}
+	switch *outFormat {
+	case "text", "json", "csv", "tsv":
+	default:
+		fail("Invalid -o: unknown output format %q", *outFormat)
+	}
 
-	var w *bufio.Writer
-	if *doCat {
-		w = bufio.NewWriter(os.Stdout)
+	format := *inFormat
+	if *doBench {
+		if !isText(format) || *exprSpec != "" || *xyFields != "" || *groupBy != "" || *timeField != "" {
+			fail("The -bench flag cannot be combined with -format, -expr, -xy, -by, or -time")
+		}
+		format = "bench"
 	}
 
-	args := flag.Args()
-	if len(args) == 0 {
-		args = []string{"-"}
+	var (
+		fields []column
+		ex     *expr
+		err    error
+	)
+	if *doBench {
+		fields = []column{{name: "value"}}
+	} else if *exprSpec != "" {
+		if *xyFields != "" {
+			fail("The -expr flag cannot be combined with -xy")
+		}
+		ex, err = parseExpr(*exprSpec)
+		if err == nil {
+			err = checkColumns(*inFormat, ex.cols)
+		}
+		if err != nil {
+			fail("Invalid -expr: %v", err)
+		} else if isText(*inFormat) && *splitter == "" && slices.ContainsFunc(ex.cols, func(c column) bool {
+			return c.index != 0
+		}) {
+			fail("Selecting fields in -expr requires -split")
+		}
+		fields = []column{{name: ex.String()}} // one value per record
+	} else {
+		fieldSpec, fieldFlag := *fieldList, "-field"
+		if *xyFields != "" {
+			fieldSpec, fieldFlag = *xyFields, "-xy"
+		}
+		fields, err = parseColumns(fieldSpec)
+		if err == nil && *xyFields != "" && len(fields) != 2 {
+			err = errors.New("exactly two fields are required")
+		}
+		if err == nil {
+			err = checkColumns(*inFormat, fields)
+		}
+		if err != nil {
+			fail("Invalid %s: %v", fieldFlag, err)
+		}
 	}
-	for _, path := range args {
-		var r io.ReadCloser
-		if path == "-" {
-			path = "<stdin>"
-			r = os.Stdin
-		} else if f, err := os.Open(path); err == nil {
-			r = f
-		} else {
-			r = f
+	var keys []column
+	if *doBench {
+		keys = []column{{name: "benchmark"}, {name: "metric"}}
+	} else if *groupBy != "" {
+		keys, err = parseColumns(*groupBy)
+		if err == nil {
+			err = checkColumns(*inFormat, keys)
+		}
+		if err != nil {
+			fail("Invalid -by: %v", err)
+		} else if slices.Contains(keys, column{}) {
+			fail("Invalid -by: field 0 cannot be a key")
+		}
+	}
+	var tb *timeBucketer
+	if *timeField != "" {
+		tcols, err := parseColumns(*timeField)
+		if err == nil && len(tcols) != 1 {
+			err = errors.New("exactly one field is required")
+		}
+		if err == nil {
+			err = checkColumns(*inFormat, tcols)
 		}
+		if err != nil {
+			fail("Invalid -time: %v", err)
+		} else if len(keys) != 0 || *doCompare {
+			fail("The -time flag cannot be combined with -by or -compare")
+		}
+		tb, err = newTimeBucketer(tcols[0], *timeLayout, *bucketWidth)
+		if err != nil {
+			fail("Invalid -time: %v", err)
+		}
+	}
+	var wcol *column
+	if *weightField != "" {
+		wcols, err := parseColumns(*weightField)
+		if err == nil && len(wcols) != 1 {
+			err = errors.New("exactly one field is required")
+		}
+		if err == nil {
+			err = checkColumns(*inFormat, wcols)
+		}
+		if err != nil {
+			fail("Invalid -weight: %v", err)
+		} else if *xyFields != "" || *doCompare || *doBench {
+			fail("The -weight flag cannot be combined with -xy, -compare, or -bench")
+		}
+		wcol = &wcols[0]
+	}
+	if (len(fields) > 1 || len(keys) != 0 || tb != nil || wcol != nil) && isText(format) && *splitter == "" {
+		fail("Selecting multiple fields or keys requires -split")
+	}
+	var split *regexp.Regexp
+	if *splitter != "" {
+		split = regexp.MustCompile(*splitter)
+	}
+	units, err := parseUnitKind(*unitMode)
+	if err != nil {
+		fail("Invalid -units: %v", err)
+	}
+	if ex != nil && units != noUnit {
+		fail("The -expr flag cannot be combined with -units")
+	}
+	if *doCount {
+		if len(fields) != 1 || *xyFields != "" {
+			fail("The -count flag requires a single -field")
+		} else if ex != nil || wcol != nil || *doBench || units != noUnit {
+			fail("The -count flag cannot be combined with -expr, -weight, -bench, or -units")
+		} else if *doHist || *doCompare || *outlierBy != "" {
+			fail("The -count flag cannot be combined with -hist, -compare, or -outliers")
+		}
+	}
+	p := newPicker(fields, keys, units, *exactMath)
+	p.expr = ex
+	p.time = tb
+	p.weight = wcol
+	p.count = *doCount
 
-		br := bufio.NewReader(r)
-		for ln := 1; ; ln++ {
-			line, err := br.ReadString('\n')
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				fail("In %s: line %d: %v", path, ln, err)
-			}
+	if (*doHist || *doSpark || *doPlot) && *outFormat != "text" {
+		fail("Histograms and charts are only supported for text output")
+	} else if *doSpark && *doPlot {
+		fail("The -spark and -plot flags cannot be combined")
+	} else if (*doSpark || *doPlot) && (*xyFields != "" || *doCompare || *doCount) {
+		fail("The -spark and -plot flags cannot be combined with -xy, -compare, or -count")
+	}
+	if *doCompare && (*doHist || *doFollow || *windowSpec != "") {
+		fail("The -compare flag cannot be combined with -hist, -follow, or -window")
+	}
+	if *xyFields != "" && (*doHist || *doCompare) {
+		fail("The -xy flag cannot be combined with -hist or -compare")
+	}
+	var outf *outlierFilter
+	if *outlierBy != "" {
+		outf, err = newOutlierFilter(*outlierBy, *threshold)
+		if err != nil {
+			fail("Invalid -outliers: %v", err)
+		} else if *xyFields != "" || *doCompare || *doFollow || *windowSpec != "" {
+			fail("The -outliers flag cannot be combined with -xy, -compare, -follow, or -window")
+		}
+	} else if *dropOutliers {
+		fail("The -drop-outliers flag requires -outliers")
+	}
 
-			v, err := p.Pick(trim(line))
+	pcts, err := parsePercentiles(*pctList)
+	if err != nil {
+		fail("Invalid -pct: %v", err)
+	}
+	var edges []*big.Rat
+	if *doHist {
+		if *edgeList != "" {
+			edges, err = parseEdges(*edgeList)
 			if err != nil {
-				log.Printf("In %s: line %d: %v", path, ln, err)
-				continue
-			}
-			s.Add(v)
-
-			if *doCat {
-				if _, err := w.Write([]byte(line)); err != nil {
-					fail("Output: %v", err)
-				}
+				fail("Invalid -edges: %v", err)
 			}
+		} else if *nBuckets <= 0 {
+			fail("Invalid -buckets: must be positive")
 		}
-		r.Close()
 	}
-	if w != nil {
-		if err := w.Flush(); err != nil {
-			log.Printf("Flushing output failed: %v", err)
+	if *ciLevel < 0 || *ciLevel >= 100 {
+		fail("Invalid -ci: must be between 0 and 100")
+	}
+	opts := collectOptions{
+		exact:     *exactMath,
+		quantiles: *doMed || *doQuar || len(pcts) != 0,
+		stream:    *doStream,
+		retain:    *doHist || *doCompare || ((*doSpark || *doPlot) && tb == nil),
+		means:     *doGMean || *doHMean,
+		moments:   *doSkew || *doKurt,
+		mode:      *doMode,
+		xy:        *xyFields != "",
+		count:     *doCount,
+		top:       countLimit(),
+	}
+	if *sortBy != "key" && !slices.Contains(statKeys(opts, pcts), *sortBy) {
+		fail("Invalid -sort: %q is not a reported statistic", *sortBy)
+	}
+	if *maxErrors < 0 {
+		fail("Invalid -max-errors: must not be negative")
+	} else if *countValues < 0 {
+		fail("Invalid -values: must not be negative")
+	}
+	ir := &inputReader{
+		format:    format,
+		split:     split,
+		pick:      p,
+		opts:      opts,
+		strict:    *strictMode,
+		maxErrors: *maxErrors,
+	}
+	if *doCat {
+		ir.cat = bufio.NewWriter(os.Stdout)
+	}
+	if *rejectFile != "" {
+		f, err := os.Create(*rejectFile)
+		if err != nil {
+			exit(exitIOError, "Invalid -rejects: %v", err)
 		}
+		defer f.Close()
+		ir.rejects = bufio.NewWriter(f)
+	}
+	rep := &reporter{
+		pick:   p,
+		pcts:   pcts,
+		edges:  edges,
+		fields: fields,
+		keys:   keys,
+	}
+	if tb != nil {
+		rep.keys = []column{{name: "time"}}
+	}
+	if *xyFields != "" {
+		rep.fields = []column{{name: *xyFields}} // one report for the pair
+	}
+	rw := os.Stdout
+	if *doCat || *saveFile == "-" {
+		rw = os.Stderr // keep stdout for the input or the saved state
 	}
 
-	out := []string{fmt.Sprintf("n=%d", s.Count())}
-	if *doSum {
-		out = append(out, fmt.Sprintf("sum=%v", ratString(s.Sum())))
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"-"}
 	}
-	if *doMin {
-		out = append(out, fmt.Sprintf("min=%v", ratString(s.Min())))
+	if *doCompare && len(args) != 2 {
+		fail("Comparing requires exactly two input files")
 	}
-	if *doMax {
-		out = append(out, fmt.Sprintf("max=%v", ratString(s.Max())))
+
+	if *mergeFiles {
+		if *doCompare || *doFollow || *windowSpec != "" || outf != nil || *doCat {
+			fail("The -merge-state flag cannot be combined with -compare, -follow, -window, -outliers, or -cat")
+		}
+		gs, mrep, err := mergeStates(args, rep, opts)
+		var perr *fs.PathError
+		if errors.As(err, &perr) {
+			exit(exitIOError, "%v", err)
+		} else if err != nil {
+			exit(exitBadInput, "%v", err)
+		} else if err := mrep.output(rw, gs); err != nil {
+			exitReport(err)
+		}
+		return
+	} else if *saveFile != "" && (*doCompare || *doFollow || *windowSpec != "") {
+		fail("The -save-state flag cannot be combined with -compare, -follow, or -window")
+	} else if *saveFile == "-" && *doCat {
+		fail("The -cat flag cannot be combined with -save-state to stdout")
 	}
-	if *doMean {
-		out = append(out, fmt.Sprintf("avg=%v", ratString(s.Mean())))
+
+	if *doFollow || *windowSpec != "" {
+		win, err := parseWindow(*windowSpec)
+		if err != nil {
+			fail("Invalid -window: %v", err)
+		}
+		if *doFollow && *interval <= 0 {
+			fail("Invalid -every: must be positive")
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+		runStream(ctx, ir, rep, rw, args, win)
+		if !ir.finish(rw) {
+			os.Exit(exitIOError)
+		}
+		return
 	}
-	if *doVar {
-		out = append(out, fmt.Sprintf("var=%v", ratString(s.Var())))
+
+	// Read the input files concurrently, unless we are echoing the input, in
+	// which case the output must be in order.
+	nproc := runtime.GOMAXPROCS(0)
+	if ir.cat != nil {
+		nproc = 1
 	}
-	if *doDev {
-		d, _ := s.Var().Float64()
-		out = append(out, fmt.Sprintf("sdv=%.2f", math.Sqrt(d)))
+	sets := make([]*groupSet, len(args))
+	samples := make([][]sample, len(args)) // with -outliers
+	g, start := taskgroup.New(nil).Limit(nproc)
+	for i, path := range args {
+		if outf != nil {
+			start.Run(func() { samples[i] = ir.readSamples(path) })
+		} else {
+			start.Run(func() { sets[i] = ir.readFile(path) })
+		}
 	}
-	if *doCat {
-		fmt.Fprintln(os.Stderr, strings.Join(out, ", "))
+	g.Wait()
+	ir.flush()
+
+	// With -outliers, the values are retained in the first pass, so that the
+	// outliers can be identified before the statistics are computed.
+	var outliers []outlier
+	if outf != nil {
+		var gs *groupSet
+		gs, outliers = ir.filterOutliers(outf, slices.Concat(samples...))
+		sets = []*groupSet{gs}
+	}
+
+	if *doCompare {
+		err = rep.compare(rw, [2]string(args), [2]*groupSet(sets))
 	} else {
-		fmt.Println(strings.Join(out, ", "))
+		gs := ir.newSet()
+		for _, set := range sets {
+			gs.Merge(set)
+		}
+		err = rep.output(rw, gs)
 	}
+	if err != nil {
+		exitReport(err)
+	}
+	if outf != nil {
+		rep.writeOutliers(rw, outliers)
+	}
+	if !ir.finish(rw) {
+		os.Exit(exitIOError)
+	}
+}
+
+func isText(format string) bool { return format == "" || format == "text" }
+
+// checkColumns reports whether the columns in cs can be used with the
+// specified input format.
+func checkColumns(format string, cs []column) error {
+	for _, c := range cs {
+		switch {
+		case c.name != "" && isText(format):
+			return fmt.Errorf("named field %q requires -format", c.name)
+		case c.name == "" && format == "jsonl":
+			return fmt.Errorf("field %d: jsonl input requires named fields", c.index)
+		case c.name == "" && c.index == 0 && !isText(format):
+			return fmt.Errorf("field 0 is only supported for text input")
+		case c.name != "" && !*useHeader && (format == "csv" || format == "tsv"):
+			return fmt.Errorf("named field %q requires -header", c.name)
+		}
+	}
+	return nil
 }
 
-func fail(msg string, args ...any) {
+// Exit codes.
+const (
+	exitUsage    = 1 // invalid flags or arguments
+	exitBadInput = 3 // too many invalid input records, or unreportable data
+	exitIOError  = 4 // an input or output could not be read or written
+)
+
+// exitReport reports an error from writing the report and exits, with the
+// status for bad input if the error depends on the data.
+func exitReport(err error) {
+	var derr dataError
+	if errors.As(err, &derr) {
+		exit(exitBadInput, "%v", err)
+	}
+	exit(exitIOError, "Output: %v", err)
+}
+
+// fail reports a usage error and exits.
+func fail(msg string, args ...any) { exit(exitUsage, msg, args...) }
+
+func exit(code int, msg string, args ...any) {
 	log.Printf(msg, args...)
-	os.Exit(1)
+	os.Exit(code)
 }
@@ -0,0 +1,209 @@
+package summary
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// The binary encodings of Stats, Float, and Int are space-separated text,
+// beginning with a version tag so that the format can be changed compatibly.
+const (
+	statsVersion = "stats1"
+	floatVersion = "float1"
+	intVersion   = "int1"
+)
+
+// MarshalBinary encodes s so that it can be restored by UnmarshalBinary, for
+// example to merge summaries computed by separate processes. It implements
+// the [encoding.BinaryMarshaler] interface.
+func (s *Stats) MarshalBinary() ([]byte, error) {
+	fs := []string{statsVersion, strconv.FormatInt(s.count, 10)}
+	for i, r := range s.rats() {
+		if s.untracked(i) {
+			fs = append(fs, "-") // not tracked
+		} else {
+			fs = append(fs, r.RatString())
+		}
+	}
+	for _, r := range []*big.Rat{s.min, s.max} {
+		if r == nil {
+			fs = append(fs, "-") // empty
+		} else {
+			fs = append(fs, r.RatString())
+		}
+	}
+	return []byte(strings.Join(fs, " ")), nil
+}
+
+// UnmarshalBinary decodes data encoded by MarshalBinary into s, replacing
+// its contents. It implements the [encoding.BinaryUnmarshaler] interface.
+func (s *Stats) UnmarshalBinary(data []byte) error {
+	*s = Stats{}
+	rs := s.rats()
+	fs, err := checkEncoding(data, statsVersion, 4+len(rs))
+	if err != nil {
+		return err
+	}
+	if s.count, err = strconv.ParseInt(fs[1], 10, 64); err != nil {
+		return fmt.Errorf("invalid count %q", fs[1])
+	}
+	s.higher = fs[2+3] != "-" // m3
+	for i, f := range fs[2:] {
+		var r *big.Rat
+		if i < len(rs) {
+			if s.untracked(i) {
+				continue
+			}
+			r = rs[i]
+		} else if f == "-" {
+			continue // no extremum
+		} else if i == len(rs) {
+			s.min = new(big.Rat)
+			r = s.min
+		} else {
+			s.max = new(big.Rat)
+			r = s.max
+		}
+		if _, ok := r.SetString(f); !ok {
+			return fmt.Errorf("invalid value %q", f)
+		}
+	}
+	switch {
+	case s.count < 0:
+		return fmt.Errorf("invalid count %d", s.count)
+	case s.count > 0 && (s.weight.Sign() <= 0 || s.weight2.Sign() <= 0 || s.min == nil || s.max == nil):
+		return errors.New("inconsistent summary")
+	}
+	return nil
+}
+
+// rats returns pointers to the rational fields of s other than the extrema,
+// in the order of the encoding. The moment sums m3 and m4 are encoded as "-"
+// if they are not tracked.
+func (s *Stats) rats() []*big.Rat {
+	return []*big.Rat{&s.sum, &s.sda, &s.sdq, &s.m3, &s.m4, &s.weight, &s.weight2}
+}
+
+// untracked reports whether the ith field of rats is a moment sum that s does
+// not track.
+func (s *Stats) untracked(i int) bool { return !s.higher && (i == 3 || i == 4) }
+
+// MarshalBinary encodes s so that it can be restored by UnmarshalBinary. It
+// implements the [encoding.BinaryMarshaler] interface.
+func (s *Float) MarshalBinary() ([]byte, error) {
+	fs := []string{floatVersion, strconv.FormatInt(s.count, 10)}
+	for _, f := range s.floats() {
+		fs = append(fs, strconv.FormatFloat(*f, 'g', -1, 64))
+	}
+	return []byte(strings.Join(fs, " ")), nil
+}
+
+// UnmarshalBinary decodes data encoded by MarshalBinary into s, replacing
+// its contents. It implements the [encoding.BinaryUnmarshaler] interface.
+func (s *Float) UnmarshalBinary(data []byte) error {
+	*s = Float{}
+	ps := s.floats()
+	fs, err := checkEncoding(data, floatVersion, 2+len(ps))
+	if err != nil {
+		return err
+	}
+	if s.count, err = strconv.ParseInt(fs[1], 10, 64); err != nil {
+		return fmt.Errorf("invalid count %q", fs[1])
+	}
+	for i, p := range ps {
+		if *p, err = strconv.ParseFloat(fs[2+i], 64); err != nil {
+			return fmt.Errorf("invalid value %q", fs[2+i])
+		}
+	}
+	switch {
+	case s.count < 0:
+		return fmt.Errorf("invalid count %d", s.count)
+	case s.count > 0 && !(s.weight > 0 && s.weight2 > 0):
+		return errors.New("inconsistent summary")
+	}
+	return nil
+}
+
+// floats returns pointers to the fields of s, other than the count, in the
+// order of the encoding.
+func (s *Float) floats() []*float64 {
+	return []*float64{&s.sum, &s.comp, &s.mean, &s.m2, &s.m3, &s.m4, &s.min, &s.max, &s.weight, &s.weight2}
+}
+
+// MarshalBinary encodes s so that it can be restored by UnmarshalBinary. It
+// implements the [encoding.BinaryMarshaler] interface.
+func (s *Int) MarshalBinary() ([]byte, error) {
+	fs := []string{intVersion}
+	for _, v := range []int64{s.count, s.min, s.max} {
+		fs = append(fs, strconv.FormatInt(v, 10))
+	}
+	for i, p := range s.intSums() {
+		if i >= 1+s.tracked() {
+			fs = append(fs, "-") // not tracked
+		} else {
+			fs = append(fs, p.Int().String())
+		}
+	}
+	return []byte(strings.Join(fs, " ")), nil
+}
+
+// UnmarshalBinary decodes data encoded by MarshalBinary into s, replacing
+// its contents. It implements the [encoding.BinaryUnmarshaler] interface.
+func (s *Int) UnmarshalBinary(data []byte) error {
+	*s = Int{}
+	ps := s.intSums()
+	fs, err := checkEncoding(data, intVersion, 4+len(ps))
+	if err != nil {
+		return err
+	}
+	for i, p := range []*int64{&s.count, &s.min, &s.max} {
+		if *p, err = strconv.ParseInt(fs[1+i], 10, 64); err != nil {
+			return fmt.Errorf("invalid value %q", fs[1+i])
+		}
+	}
+	s.higher = fs[4+4] != "-" // Σw·v³
+	for i, p := range ps {
+		f := fs[4+i]
+		if i >= 1+s.tracked() {
+			continue
+		}
+		z, ok := new(big.Int).SetString(f, 10)
+		if !ok {
+			return fmt.Errorf("invalid value %q", f)
+		}
+		p.set(z)
+	}
+	switch {
+	case s.count < 0:
+		return fmt.Errorf("invalid count %d", s.count)
+	case s.count > 0 && (s.sums[0].Int().Sign() <= 0 || s.weight2.Int().Sign() <= 0 || s.min > s.max):
+		return errors.New("inconsistent summary")
+	}
+	return nil
+}
+
+// intSums returns pointers to the sums of s, in the order of the encoding:
+// the sum of squared weights, then the power sums. The power sums for k = 3
+// and 4 are encoded as "-" if they are not tracked.
+func (s *Int) intSums() []*intSum {
+	return []*intSum{&s.weight2, &s.sums[0], &s.sums[1], &s.sums[2], &s.sums[3], &s.sums[4]}
+}
+
+// checkEncoding splits data into fields, and reports an error if it does not
+// have the given version tag and number of fields.
+func checkEncoding(data []byte, version string, n int) ([]string, error) {
+	fs := strings.Fields(string(data))
+	if len(fs) == 0 || fs[0] != version {
+		tag := "empty"
+		if len(fs) != 0 {
+			tag = strconv.Quote(fs[0])
+		}
+		return nil, fmt.Errorf("unsupported encoding (%s, want %q)", tag, version)
+	} else if len(fs) != n {
+		return nil, fmt.Errorf("invalid encoding: got %d fields, want %d", len(fs), n)
+	}
+	return fs, nil
+}
@@ -0,0 +1,153 @@
+package summary
+
+import "math"
+
+// Float accumulates summary statistics using float64 arithmetic. It is much
+// faster than [Stats], at the cost of rounding error. To limit the error,
+// the sum is computed with Neumaier's compensated summation, and the mean and
+// central moments with Welford's algorithm. The zero value is ready for use and
+// represents an empty sequence.
+type Float struct {
+	sum, comp float64 // running sum and compensation term
+	mean, m2  float64 // running mean and sum of squared differences from it
+	m3, m4    float64 // sums of cubed and 4th-power differences from the mean
+	min, max  float64
+	count     int64
+
+	weight, weight2 float64 // sum of weights and of squared weights
+}
+
+// Count returns the number of values added to s.
+func (s *Float) Count() int64 { return s.count }
+
+// Weight returns the total weight of the values added to s.
+func (s *Float) Weight() float64 { return s.weight }
+
+// EffectiveCount returns Kish's effective sample size of the values added to
+// s, or NaN if s is empty (see [Stats.EffectiveCount]).
+func (s *Float) EffectiveCount() float64 { return s.orNaN(s.weight * s.weight / s.weight2) }
+
+// Sum returns the weighted sum of all values added to s.
+func (s *Float) Sum() float64 { return s.sum + s.comp }
+
+// Min returns the minimum value added to s, or NaN if s is empty.
+func (s *Float) Min() float64 { return s.orNaN(s.min) }
+
+// Max returns the maximum value added to s, or NaN if s is empty.
+func (s *Float) Max() float64 { return s.orNaN(s.max) }
+
+// Mean returns the weighted arithmetic mean of the values added to s, or NaN
+// if s is empty.
+func (s *Float) Mean() float64 { return s.orNaN(s.mean) }
+
+// Var returns the sample variance of the values added to s, or NaN if fewer
+// than two values have been added. For weighted values, this is the estimate
+// for reliability weights (see [Stats.Var]).
+func (s *Float) Var() float64 {
+	d := s.weight - s.weight2/s.weight
+	if s.count < 2 || d == 0 {
+		return math.NaN()
+	}
+	return s.m2 / d
+}
+
+// Moment returns the kth (weighted) central moment of the values added to s,
+// for k from 2 to 4, or NaN if s is empty. Moment panics if k is out of range.
+func (s *Float) Moment(k int) float64 {
+	var m float64
+	switch k {
+	case 2:
+		m = s.m2
+	case 3:
+		m = s.m3
+	case 4:
+		m = s.m4
+	default:
+		panic("summary: moment out of range")
+	}
+	return s.orNaN(m / s.weight)
+}
+
+func (s *Float) orNaN(v float64) float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return v
+}
+
+// Add adds v to s with unit weight.
+func (s *Float) Add(v float64) { s.AddWeighted(v, 1) }
+
+// AddWeighted adds v to s with weight w, which must not be negative. A value
+// with zero weight is ignored.
+func (s *Float) AddWeighted(v, w float64) {
+	if w < 0 {
+		panic("summary: negative weight")
+	} else if w == 0 {
+		return
+	}
+	s.addSum(v * w)
+	s.count++
+	if s.count == 1 || v < s.min {
+		s.min = v
+	}
+	if s.count == 1 || v > s.max {
+		s.max = v
+	}
+
+	// See Stats.AddWeighted for the derivation.
+	tot := s.weight
+	s.weight += w
+	s.weight2 += w * w
+	d := v - s.mean
+	dn := d * w / s.weight
+	dn2 := dn * dn
+	t := d * dn * tot
+	s.m4 += t*dn2*(tot*tot-tot*w+w*w)/(w*w) + 6*dn2*s.m2 - 4*dn*s.m3
+	s.m3 += t*dn*(tot-w)/w - 3*dn*s.m2
+	s.m2 += t
+	s.mean += dn
+}
+
+// addSum adds v to the running sum using Neumaier's variant of Kahan
+// summation, which also handles the case where v is larger in magnitude than
+// the sum so far.
+func (s *Float) addSum(v float64) {
+	t := s.sum + v
+	if math.Abs(s.sum) >= math.Abs(v) {
+		s.comp += (s.sum - t) + v
+	} else {
+		s.comp += (v - t) + s.sum
+	}
+	s.sum = t
+}
+
+// Merge adds the values summarized by o to s, as if each of them had been
+// passed to s.Add. The contents of o are not modified.
+func (s *Float) Merge(o *Float) {
+	if o.count == 0 {
+		return
+	} else if s.count == 0 {
+		*s = *o
+		return
+	}
+
+	// See Stats.Merge for the derivation.
+	n1, n2 := s.weight, o.weight
+	n := n1 + n2
+	d := o.mean - s.mean
+	d2 := d * d
+	s.mean += d * n2 / n
+	s.m4 += o.m4 + d2*d2*n1*n2*(n1*n1-n1*n2+n2*n2)/(n*n*n) +
+		6*d2*(n1*n1*o.m2+n2*n2*s.m2)/(n*n) + 4*d*(n1*o.m3-n2*s.m3)/n
+	s.m3 += o.m3 + d2*d*n1*n2*(n1-n2)/(n*n) + 3*d*(n1*o.m2-n2*s.m2)/n
+	s.m2 += o.m2 + d2*n1*n2/n
+
+	s.addSum(o.sum)
+	s.addSum(o.comp)
+	s.count += o.count
+	s.weight += o.weight
+	s.weight2 += o.weight2
+	s.min = min(s.min, o.min)
+	s.max = max(s.max, o.max)
+}
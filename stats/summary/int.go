@@ -0,0 +1,271 @@
+package summary
+
+import (
+	"math"
+	"math/big"
+)
+
+// Int accumulates summary statistics of integer values with integer weights,
+// exactly. Instead of the running mean and central moments, it keeps the sums
+// of the weights and of the weighted powers of the values, from which the
+// moments are computed when they are reported. Each sum is kept in an int64
+// until adding to it would overflow, so for values of moderate size Int is
+// nearly as fast as [Float], and unlike Float it has no rounding error. The
+// 3rd and 4th power sums are tracked only if requested with
+// [Int.TrackHigherMoments]. The zero value is ready for use and represents an
+// empty sequence.
+type Int struct {
+	sums     [5]intSum // Σw·vᵏ for k from 0 to 4; Σw is the total weight
+	weight2  intSum    // sum of squared weights
+	min, max int64
+	count    int64
+	higher   bool // the sums for k = 3 and 4 are tracked
+}
+
+// TrackHigherMoments makes s track the 3rd and 4th central moments, which
+// are otherwise not reported by [Int.Moment]. It must be called before any
+// values are added.
+func (s *Int) TrackHigherMoments() {
+	if s.count != 0 {
+		panic("summary: TrackHigherMoments after Add")
+	}
+	s.higher = true
+}
+
+// Count returns the number of values added to s.
+func (s *Int) Count() int64 { return s.count }
+
+// Weight returns the total weight of the values added to s.
+func (s *Int) Weight() *big.Rat { return s.sums[0].Rat() }
+
+// EffectiveCount returns Kish's effective sample size of the values added to
+// s, or nil if s is empty (see [Stats.EffectiveCount]).
+func (s *Int) EffectiveCount() *big.Rat {
+	if s.count == 0 {
+		return nil
+	}
+	w := s.Weight()
+	w.Mul(w, w)
+	return w.Quo(w, s.weight2.Rat())
+}
+
+// Sum returns the weighted sum of all values added to s.
+func (s *Int) Sum() *big.Rat { return s.sums[1].Rat() }
+
+// Min returns the minimum value added to s, or nil if s is empty.
+func (s *Int) Min() *big.Rat {
+	if s.count == 0 {
+		return nil
+	}
+	return big.NewRat(s.min, 1)
+}
+
+// Max returns the maximum value added to s, or nil if s is empty.
+func (s *Int) Max() *big.Rat {
+	if s.count == 0 {
+		return nil
+	}
+	return big.NewRat(s.max, 1)
+}
+
+// Mean returns the weighted arithmetic mean of the values added to s, or nil
+// if s is empty.
+func (s *Int) Mean() *big.Rat {
+	if s.count == 0 {
+		return nil
+	}
+	m := s.Sum()
+	return m.Quo(m, s.Weight())
+}
+
+// Var returns the sample variance of the values added to s, or nil if fewer
+// than two values have been added. For weighted values, this is the estimate
+// for reliability weights (see [Stats.Var]).
+func (s *Int) Var() *big.Rat {
+	if s.count < 2 {
+		return nil
+	}
+	w := s.Weight()
+	d := s.weight2.Rat()
+	d.Sub(w, d.Quo(d, w))
+	if d.Sign() == 0 {
+		return nil
+	}
+	return d.Quo(s.central(2), d)
+}
+
+// Moment returns the kth (weighted) central moment of the values added to s,
+// for k from 2 to 4, or nil if s is empty. The 3rd and 4th moments are nil
+// unless s tracks them (see [Int.TrackHigherMoments]). Moment panics if k is
+// out of range.
+func (s *Int) Moment(k int) *big.Rat {
+	if k < 2 || k > 4 {
+		panic("summary: moment out of range")
+	} else if s.count == 0 || (k > 2 && !s.higher) {
+		return nil
+	}
+	m := s.central(k)
+	return m.Quo(m, s.Weight())
+}
+
+// central returns the kth central moment sum Σw·(v-μ)ᵏ of the values added
+// to s, where μ is the mean, expanded binomially in terms of the power sums
+// as Σⱼ C(k,j)·(-μ)ᵏ⁻ʲ·Σw·vʲ. It requires that s is not empty.
+func (s *Int) central(k int) *big.Rat {
+	nmu := s.Mean()
+	nmu.Neg(nmu)
+	out := new(big.Rat)
+	p := big.NewRat(1, 1) // (-μ)ᵏ⁻ʲ
+	c := int64(1)         // C(k,j)
+	for j := k; j >= 0; j-- {
+		t := s.sums[j].Rat()
+		t.Mul(t, p).Mul(t, big.NewRat(c, 1))
+		out.Add(out, t)
+		p.Mul(p, nmu)
+		c = c * int64(j) / int64(k-j+1)
+	}
+	return out
+}
+
+// Add adds v to s with unit weight.
+func (s *Int) Add(v int64) { s.AddWeighted(v, 1) }
+
+// AddWeighted adds v to s with weight w, which must not be negative. A value
+// with zero weight is ignored. As for [Stats.AddWeighted], adding a value
+// with weight k is equivalent to adding it k times, except for the variance.
+func (s *Int) AddWeighted(v, w int64) {
+	if w < 0 {
+		panic("summary: negative weight")
+	} else if w == 0 {
+		return
+	}
+	s.count++
+	if s.count == 1 || v < s.min {
+		s.min = v
+	}
+	if s.count == 1 || v > s.max {
+		s.max = v
+	}
+	s.weight2.addProduct(w, w)
+
+	// Add w·vᵏ to each tracked sum, computing it in an int64 until it
+	// overflows, and in pb after that.
+	p, pb := w, (*big.Int)(nil)
+	for k := range s.tracked() {
+		if k > 0 && pb != nil {
+			pb.Mul(pb, big.NewInt(v))
+		} else if k > 0 {
+			if q, ok := mul64(p, v); ok {
+				p = q
+			} else {
+				pb = new(big.Int).Mul(big.NewInt(p), big.NewInt(v))
+			}
+		}
+		if pb != nil {
+			s.sums[k].addBig(pb)
+		} else {
+			s.sums[k].add(p)
+		}
+	}
+}
+
+// tracked returns the number of power sums tracked by s.
+func (s *Int) tracked() int {
+	if s.higher {
+		return 5
+	}
+	return 3
+}
+
+// Merge adds the values summarized by o to s, as if each of them had been
+// passed to s.Add. The result is exact. The contents of o are not modified.
+func (s *Int) Merge(o *Int) {
+	if o.count == 0 {
+		return
+	} else if !o.higher {
+		s.higher = false // the merged moments are unknown
+	}
+	if s.count == 0 {
+		s.min, s.max = o.min, o.max
+	} else {
+		s.min, s.max = min(s.min, o.min), max(s.max, o.max)
+	}
+	for k := range s.sums {
+		s.sums[k].merge(&o.sums[k])
+	}
+	s.weight2.merge(&o.weight2)
+	s.count += o.count
+}
+
+// An intSum is an exact sum of integers. It is kept in an int64 until adding
+// to it would overflow, and the excess is then carried in a big.Int.
+type intSum struct {
+	small int64
+	large *big.Int // the remainder of the sum beyond small, or nil
+}
+
+func (s *intSum) add(v int64) {
+	if t := s.small + v; (v >= 0) == (t >= s.small) {
+		s.small = t
+		return
+	}
+	s.addBig(big.NewInt(s.small))
+	s.small = v
+}
+
+func (s *intSum) addBig(v *big.Int) {
+	if s.large == nil {
+		s.large = new(big.Int)
+	}
+	s.large.Add(s.large, v)
+}
+
+// addProduct adds a·b to s.
+func (s *intSum) addProduct(a, b int64) {
+	if p, ok := mul64(a, b); ok {
+		s.add(p)
+	} else {
+		s.addBig(new(big.Int).Mul(big.NewInt(a), big.NewInt(b)))
+	}
+}
+
+func (s *intSum) merge(o *intSum) {
+	s.add(o.small)
+	if o.large != nil {
+		s.addBig(o.large)
+	}
+}
+
+// Int returns the value of s.
+func (s *intSum) Int() *big.Int {
+	z := big.NewInt(s.small)
+	if s.large != nil {
+		z.Add(z, s.large)
+	}
+	return z
+}
+
+// Rat returns the value of s as a rational.
+func (s *intSum) Rat() *big.Rat { return new(big.Rat).SetInt(s.Int()) }
+
+// set sets the value of s to z.
+func (s *intSum) set(z *big.Int) {
+	*s = intSum{}
+	if z.IsInt64() {
+		s.small = z.Int64()
+	} else {
+		s.large = new(big.Int).Set(z)
+	}
+}
+
+// mul64 returns a·b, and reports whether it fits in an int64.
+func mul64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	p := a * b
+	if p/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	return p, true
+}
@@ -0,0 +1,144 @@
+package summary_test
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/creachadair/misctools/stats/summary"
+)
+
+// checkInt reports whether the statistics of got match those of want, which
+// summarizes the same values exactly.
+func checkInt(t *testing.T, got *summary.Int, want *summary.Stats) {
+	t.Helper()
+	if got.Count() != want.Count() {
+		t.Errorf("Count: got %d, want %d", got.Count(), want.Count())
+	}
+	checkEqual(t, "Weight", got.Weight(), want.Weight())
+	checkEqual(t, "EffectiveCount", got.EffectiveCount(), want.EffectiveCount())
+	checkEqual(t, "Sum", got.Sum(), want.Sum())
+	checkEqual(t, "Min", got.Min(), want.Min())
+	checkEqual(t, "Max", got.Max(), want.Max())
+	checkEqual(t, "Mean", got.Mean(), want.Mean())
+	checkEqual(t, "Var", got.Var(), want.Var())
+	for k := 2; k <= 4; k++ {
+		checkEqual(t, fmt.Sprintf("Moment(%d)", k), got.Moment(k), want.Moment(k))
+	}
+}
+
+func TestIntMatchesExact(t *testing.T) {
+	tests := []struct {
+		name string
+		gen  func(*rand.Rand) int64
+	}{
+		{"Small", func(r *rand.Rand) int64 { return r.Int64N(2000) - 1000 }},
+
+		// Timestamps in nanoseconds exceed the exact range of float64, and
+		// their powers overflow an int64.
+		{"Nanoseconds", func(r *rand.Rand) int64 { return 1_700_000_000_000_000_000 + r.Int64N(1e12) }},
+
+		// The sums themselves overflow an int64.
+		{"Extreme", func(r *rand.Rand) int64 {
+			if r.IntN(2) == 0 {
+				return math.MaxInt64 - r.Int64N(10)
+			}
+			return math.MinInt64 + r.Int64N(10)
+		}},
+	}
+	for _, tc := range tests {
+		for _, weighted := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/weighted=%v", tc.name, weighted), func(t *testing.T) {
+				rng := rand.New(rand.NewPCG(5, 8))
+				var got summary.Int
+				var want summary.Stats
+				got.TrackHigherMoments()
+				want.TrackHigherMoments()
+				for range 500 {
+					v, w := tc.gen(rng), int64(1)
+					if weighted {
+						w = rng.Int64N(5)
+					}
+					got.AddWeighted(v, w)
+					want.AddWeighted(big.NewRat(v, 1), big.NewRat(w, 1))
+				}
+				checkInt(t, &got, &want)
+			})
+		}
+	}
+}
+
+func TestIntEmpty(t *testing.T) {
+	var s summary.Int
+	checkInt(t, &s, new(summary.Stats))
+
+	// Without TrackHigherMoments, only the variance is reported.
+	s.Add(3)
+	s.Add(5)
+	checkEqual(t, "Moment(2)", s.Moment(2), big.NewRat(1, 1))
+	checkEqual(t, "Moment(3)", s.Moment(3), nil)
+	checkEqual(t, "Moment(4)", s.Moment(4), nil)
+}
+
+func TestIntMerge(t *testing.T) {
+	vs := []int64{math.MaxInt64, 7, -3, math.MaxInt64, 1 << 40, 0, -1 << 50}
+	var want summary.Stats
+	want.TrackHigherMoments()
+	for _, v := range vs {
+		want.Add(big.NewRat(v, 1))
+	}
+	for i := range len(vs) + 1 {
+		var a, b summary.Int
+		a.TrackHigherMoments()
+		b.TrackHigherMoments()
+		for _, v := range vs[:i] {
+			a.Add(v)
+		}
+		for _, v := range vs[i:] {
+			b.Add(v)
+		}
+		a.Merge(&b)
+		t.Run(fmt.Sprintf("Split%d", i), func(t *testing.T) { checkInt(t, &a, &want) })
+	}
+}
+
+func TestIntEncoding(t *testing.T) {
+	var empty, s, low summary.Int
+	s.TrackHigherMoments()
+	for _, v := range []int64{3, -1, math.MaxInt64, 1, 5} {
+		s.AddWeighted(v, v&7)
+		low.AddWeighted(v, v&7)
+	}
+	for _, in := range []*summary.Int{&empty, &s, &low} {
+		data, err := in.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		var out summary.Int
+		if err := out.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary(%q): %v", data, err)
+		}
+		if got, _ := out.MarshalBinary(); string(got) != string(data) {
+			t.Errorf("Round trip: got %q, want %q", got, data)
+		}
+		if out.Count() != in.Count() || !sameRat(out.Min(), in.Min()) || !sameRat(out.Var(), in.Var()) ||
+			!sameRat(out.Moment(4), in.Moment(4)) {
+			t.Errorf("Decoded %q: got n=%d min=%v var=%v", data, out.Count(), out.Min(), out.Var())
+		}
+	}
+
+	for _, bad := range []string{
+		"", "float1 0 0 0 0 0 0 0 0 0", "int1 1 2 3",
+		"int1 1 2 2 x 1 2 4 - -",  // invalid sum
+		"int1 -1 0 0 0 0 0 0 - -", // negative count
+		"int1 2 1 5 0 0 6 26 - -", // values with no weight
+		"int1 2 5 1 2 2 6 26 - -", // min > max
+	} {
+		var out summary.Int
+		if err := out.UnmarshalBinary([]byte(bad)); err == nil {
+			t.Errorf("UnmarshalBinary(%q): got nil, want error", bad)
+		}
+	}
+}
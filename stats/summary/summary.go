@@ -0,0 +1,293 @@
+// Package summary computes summary statistics over a sequence of values.
+//
+// A [Stats] value accumulates the count, sum, extrema, and running mean and
+// central moments of the values added to it, using exact rational arithmetic.
+// The moments are updated incrementally with Welford's algorithm and its
+// extension to higher moments, so values need not be retained. The 3rd and 4th
+// moments are costly to maintain exactly, so they are tracked only if
+// requested with [Stats.TrackHigherMoments]. Values may be
+// given weights, in which case the sum, mean, and moments are weighted.
+// Partial results computed separately, for example over shards of a larger
+// input, can be combined exactly using [Stats.Merge].
+//
+// A [Float] value accumulates the same statistics using float64 arithmetic,
+// which is much faster but subject to rounding error. An [Int] value
+// accumulates them for integer values, exactly and nearly as fast as Float.
+package summary
+
+import "math/big"
+
+// Stats accumulates summary statistics. The zero value is ready for use and
+// represents an empty sequence.
+type Stats struct {
+	sum      big.Rat
+	sda, sdq big.Rat // running mean and sum of squared differences from it
+	m3, m4   big.Rat // sums of cubed and 4th-power differences from the mean
+	min, max *big.Rat
+	count    int64
+
+	weight, weight2 big.Rat // sum of weights and of squared weights
+	higher          bool    // m3 and m4 are tracked
+}
+
+// TrackHigherMoments makes s track the 3rd and 4th central moments, which
+// are otherwise not reported by [Stats.Moment]. This makes [Stats.Add]
+// several times slower. It must be called before any values are added.
+func (s *Stats) TrackHigherMoments() {
+	if s.count != 0 {
+		panic("summary: TrackHigherMoments after Add")
+	}
+	s.higher = true
+}
+
+// Count returns the number of values added to s.
+func (s *Stats) Count() int64 { return s.count }
+
+// Weight returns the total weight of the values added to s. If all values
+// have unit weight, this is equal to the count.
+func (s *Stats) Weight() *big.Rat { return new(big.Rat).Set(&s.weight) }
+
+// EffectiveCount returns Kish's effective sample size of the values added to
+// s, (Σw)²/Σw², or nil if s is empty. If all values have equal weight, this is
+// equal to the count.
+func (s *Stats) EffectiveCount() *big.Rat {
+	if s.count == 0 {
+		return nil
+	}
+	n := new(big.Rat).Mul(&s.weight, &s.weight)
+	return n.Quo(n, &s.weight2)
+}
+
+// Sum returns the weighted sum of all values added to s.
+func (s *Stats) Sum() *big.Rat { return new(big.Rat).Set(&s.sum) }
+
+// Min returns the minimum value added to s, or nil if s is empty.
+func (s *Stats) Min() *big.Rat { return copyRat(s.min) }
+
+// Max returns the maximum value added to s, or nil if s is empty.
+func (s *Stats) Max() *big.Rat { return copyRat(s.max) }
+
+// Mean returns the weighted arithmetic mean of the values added to s, or nil
+// if s is empty.
+func (s *Stats) Mean() *big.Rat {
+	if s.count == 0 {
+		return nil
+	}
+	return new(big.Rat).Quo(&s.sum, &s.weight)
+}
+
+// Var returns the sample variance of the values added to s, or nil if fewer
+// than two values have been added. For weighted values, this is the unbiased
+// estimate for reliability weights, M₂/(W - Σw²/W), where W is the total
+// weight; with unit weights this is M₂/(n-1).
+func (s *Stats) Var() *big.Rat {
+	if s.count < 2 {
+		return nil
+	}
+	d := new(big.Rat).Quo(&s.weight2, &s.weight)
+	d.Sub(&s.weight, d)
+	if d.Sign() == 0 {
+		return nil
+	}
+	return d.Quo(&s.sdq, d)
+}
+
+// Moment returns the kth (weighted) central moment of the values added to s,
+// for k from 2 to 4, or nil if s is empty. The 2nd central moment is the
+// population variance. The 3rd and 4th moments are nil unless s tracks them
+// (see [Stats.TrackHigherMoments]). Moment panics if k is out of range.
+func (s *Stats) Moment(k int) *big.Rat {
+	var m *big.Rat
+	switch k {
+	case 2:
+		m = &s.sdq
+	case 3:
+		m = &s.m3
+	case 4:
+		m = &s.m4
+	default:
+		panic("summary: moment out of range")
+	}
+	if s.count == 0 || (k > 2 && !s.higher) {
+		return nil
+	}
+	return new(big.Rat).Quo(m, &s.weight)
+}
+
+// Add adds v to s with unit weight. The caller may modify v after Add
+// returns.
+func (s *Stats) Add(v *big.Rat) { s.AddWeighted(v, one) }
+
+var one = big.NewRat(1, 1)
+
+// AddWeighted adds v to s with weight w, which must not be negative. A value
+// with zero weight is ignored. Adding a value with an integer weight k is
+// equivalent to adding it k times, but the variance is estimated as for
+// reliability weights (see [Stats.Var]). The caller may modify v and w after
+// AddWeighted returns.
+func (s *Stats) AddWeighted(v, w *big.Rat) {
+	if w.Sign() < 0 {
+		panic("summary: negative weight")
+	} else if w.Sign() == 0 {
+		return
+	}
+	unit := w == one || w.Cmp(one) == 0
+	if unit {
+		s.sum.Add(&s.sum, v)
+	} else {
+		s.sum.Add(&s.sum, new(big.Rat).Mul(v, w))
+	}
+	s.count++
+	if s.min == nil || v.Cmp(s.min) < 0 {
+		s.min = new(big.Rat).Set(v)
+	}
+	if s.max == nil || v.Cmp(s.max) > 0 {
+		s.max = new(big.Rat).Set(v)
+	}
+
+	// Update the mean and central moment sums as described by Pébay (2008),
+	// by merging (see Merge) a single value v of weight w into the values of
+	// total weight W so far, using the moments before the update on the
+	// right:
+	//
+	//    δ = v - μ,  W' = W + w,  δₙ = δ·w/W',  t = δ·δₙ·W
+	//    μ  += δₙ
+	//    M₄ += t·δₙ²·(W² - W·w + w²)/w² + 6·δₙ²·M₂ - 4·δₙ·M₃
+	//    M₃ += t·δₙ·(W - w)/w - 3·δₙ·M₂
+	//    M₂ += t
+	//
+	// With unit weights, W' = n and these are Welford's updates and their
+	// extension to higher moments.
+	tot := new(big.Rat).Set(&s.weight) // W
+	w2 := one
+	if !unit {
+		w2 = new(big.Rat).Mul(w, w)
+	}
+	s.weight.Add(&s.weight, w)
+	s.weight2.Add(&s.weight2, w2)
+
+	delta := new(big.Rat).Sub(v, &s.sda)
+	dn := new(big.Rat).Quo(delta, &s.weight)
+	if !unit {
+		dn.Mul(dn, w)
+	}
+	t := new(big.Rat).Mul(delta, dn)
+	t.Mul(t, tot)
+	if s.higher {
+		s.addHigher(t, dn, tot, w, w2)
+	}
+	s.sdq.Add(&s.sdq, t)
+	s.sda.Add(&s.sda, dn)
+}
+
+// addHigher updates the 3rd and 4th moment sums for AddWeighted, before the
+// update of the mean and M₂.
+func (s *Stats) addHigher(t, dn, tot, w, w2 *big.Rat) {
+	dn2 := new(big.Rat).Mul(dn, dn)
+	poly := new(big.Rat).Sub(tot, w) // W² - W·w + w² = W(W - w) + w²
+	poly.Mul(poly, tot).Add(poly, w2)
+	tmp := new(big.Rat)
+	s.m4.Add(&s.m4, tmp.Mul(t, dn2).Mul(tmp, poly).Quo(tmp, w2))
+	s.m4.Add(&s.m4, tmp.Mul(dn2, &s.sdq).Mul(tmp, big.NewRat(6, 1)))
+	s.m4.Sub(&s.m4, tmp.Mul(dn, &s.m3).Mul(tmp, big.NewRat(4, 1)))
+
+	tmp2 := new(big.Rat).Sub(tot, w)
+	s.m3.Add(&s.m3, tmp.Mul(t, dn).Mul(tmp, tmp2).Quo(tmp, w))
+	s.m3.Sub(&s.m3, tmp.Mul(dn, &s.sdq).Mul(tmp, big.NewRat(3, 1)))
+}
+
+// Merge adds the values summarized by o to s, as if each of them had been
+// passed to s.Add. The result is exact. The contents of o are not modified.
+func (s *Stats) Merge(o *Stats) {
+	if o.count == 0 {
+		return
+	} else if !o.higher {
+		s.higher = false // the merged moments are unknown
+	}
+	if s.count == 0 {
+		s.sum.Set(&o.sum)
+		s.sda.Set(&o.sda)
+		s.sdq.Set(&o.sdq)
+		s.m3.Set(&o.m3)
+		s.m4.Set(&o.m4)
+		s.min, s.max, s.count = copyRat(o.min), copyRat(o.max), o.count
+		s.weight.Set(&o.weight)
+		s.weight2.Set(&o.weight2)
+		return
+	}
+
+	// Combine the means and squared differences as described by Chan, Golub &
+	// LeVeque (1979), and the higher moments as described by Pébay (2008),
+	// where n₁ and n₂ are the total weights:
+	//
+	//    δ = μ₂ - μ₁
+	//    μ = μ₁ + δ·n₂/n
+	//    M₂ = M₂₁ + M₂₂ + δ²·n₁·n₂/n
+	//    M₃ = M₃₁ + M₃₂ + δ³·n₁·n₂·(n₁-n₂)/n² + 3δ·(n₁·M₂₂ - n₂·M₂₁)/n
+	//    M₄ = M₄₁ + M₄₂ + δ⁴·n₁·n₂·(n₁²-n₁·n₂+n₂²)/n³
+	//         + 6δ²·(n₁²·M₂₂ + n₂²·M₂₁)/n² + 4δ·(n₁·M₃₂ - n₂·M₃₁)/n
+	//
+	n1, n2 := &s.weight, &o.weight
+	n := new(big.Rat).Add(n1, n2)
+	delta := new(big.Rat).Sub(&o.sda, &s.sda)
+	d2 := new(big.Rat).Mul(delta, delta)
+	nn := new(big.Rat).Mul(n1, n2) // n₁·n₂
+
+	dm := new(big.Rat).Mul(delta, n2)
+	s.sda.Add(&s.sda, dm.Quo(dm, n))
+
+	if s.higher {
+		s.mergeHigher(o, delta, d2, nn)
+	}
+
+	dq := new(big.Rat).Mul(d2, nn)
+	dq.Quo(dq, n)
+	s.sdq.Add(&s.sdq, &o.sdq).Add(&s.sdq, dq)
+
+	s.sum.Add(&s.sum, &o.sum)
+	s.count += o.count
+	s.weight.Add(&s.weight, &o.weight)
+	s.weight2.Add(&s.weight2, &o.weight2)
+	if o.min.Cmp(s.min) < 0 {
+		s.min = copyRat(o.min)
+	}
+	if o.max.Cmp(s.max) > 0 {
+		s.max = copyRat(o.max)
+	}
+}
+
+// mergeHigher updates the 3rd and 4th moment sums for Merge, before the
+// update of M₂ and the weights.
+func (s *Stats) mergeHigher(o *Stats, delta, d2, nn *big.Rat) {
+	n1, n2 := &s.weight, &o.weight
+	n := new(big.Rat).Add(n1, n2)
+
+	// M₄, using the old M₂ and M₃.
+	tmp, tmp2 := new(big.Rat), new(big.Rat)
+	poly := new(big.Rat).Mul(n1, n1) // n₁²-n₁·n₂+n₂²
+	poly.Sub(poly, nn).Add(poly, tmp.Mul(n2, n2))
+	m4 := new(big.Rat).Add(&s.m4, &o.m4)
+	m4.Add(m4, tmp.Mul(d2, d2).Mul(tmp, nn).Mul(tmp, poly).Quo(tmp, n).Quo(tmp, n).Quo(tmp, n))
+	tmp.Mul(n1, n1).Mul(tmp, &o.sdq)
+	tmp.Add(tmp, tmp2.Mul(n2, n2).Mul(tmp2, &s.sdq))
+	m4.Add(m4, tmp.Mul(tmp, d2).Mul(tmp, big.NewRat(6, 1)).Quo(tmp, n).Quo(tmp, n))
+	tmp.Mul(n1, &o.m3).Sub(tmp, tmp2.Mul(n2, &s.m3))
+	m4.Add(m4, tmp.Mul(tmp, delta).Mul(tmp, big.NewRat(4, 1)).Quo(tmp, n))
+
+	// M₃, using the old M₂.
+	m3 := new(big.Rat).Add(&s.m3, &o.m3)
+	tmp2.Sub(n1, n2)
+	m3.Add(m3, tmp.Mul(d2, delta).Mul(tmp, nn).Mul(tmp, tmp2).Quo(tmp, n).Quo(tmp, n))
+	tmp.Mul(n1, &o.sdq).Sub(tmp, tmp2.Mul(n2, &s.sdq))
+	m3.Add(m3, tmp.Mul(tmp, delta).Mul(tmp, big.NewRat(3, 1)).Quo(tmp, n))
+
+	s.m3.Set(m3)
+	s.m4.Set(m4)
+}
+
+func copyRat(r *big.Rat) *big.Rat {
+	if r == nil {
+		return nil
+	}
+	return new(big.Rat).Set(r)
+}
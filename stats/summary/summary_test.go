@@ -0,0 +1,252 @@
+package summary_test
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/creachadair/misctools/stats/summary"
+)
+
+func rats(vs ...int64) []*big.Rat {
+	out := make([]*big.Rat, len(vs))
+	for i, v := range vs {
+		out[i] = big.NewRat(v, 1)
+	}
+	return out
+}
+
+func checkEqual(t *testing.T, label string, got, want *big.Rat) {
+	t.Helper()
+	if (got == nil) != (want == nil) || (got != nil && got.Cmp(want) != 0) {
+		t.Errorf("%s: got %v, want %v", label, got, want)
+	}
+}
+
+func checkStats(t *testing.T, got, want *summary.Stats) {
+	t.Helper()
+	if got.Count() != want.Count() {
+		t.Errorf("Count: got %d, want %d", got.Count(), want.Count())
+	}
+	checkEqual(t, "Sum", got.Sum(), want.Sum())
+	checkEqual(t, "Min", got.Min(), want.Min())
+	checkEqual(t, "Max", got.Max(), want.Max())
+	checkEqual(t, "Mean", got.Mean(), want.Mean())
+	checkEqual(t, "Var", got.Var(), want.Var())
+	for k := 2; k <= 4; k++ {
+		checkEqual(t, fmt.Sprintf("Moment(%d)", k), got.Moment(k), want.Moment(k))
+	}
+}
+
+func TestStats(t *testing.T) {
+	var s summary.Stats
+	s.TrackHigherMoments()
+	if s.Count() != 0 || s.Min() != nil || s.Max() != nil || s.Mean() != nil || s.Var() != nil || s.Moment(2) != nil {
+		t.Errorf("Empty stats: got n=%d min=%v max=%v mean=%v var=%v m2=%v",
+			s.Count(), s.Min(), s.Max(), s.Mean(), s.Var(), s.Moment(2))
+	}
+
+	for _, v := range rats(2, 4, 4, 4, 5, 5, 7, 9) {
+		s.Add(v)
+	}
+	if s.Count() != 8 {
+		t.Errorf("Count: got %d, want 8", s.Count())
+	}
+	checkEqual(t, "Sum", s.Sum(), big.NewRat(40, 1))
+	checkEqual(t, "Min", s.Min(), big.NewRat(2, 1))
+	checkEqual(t, "Max", s.Max(), big.NewRat(9, 1))
+	checkEqual(t, "Mean", s.Mean(), big.NewRat(5, 1))
+	checkEqual(t, "Var", s.Var(), big.NewRat(32, 7))
+	checkEqual(t, "Moment(2)", s.Moment(2), big.NewRat(4, 1))
+	checkEqual(t, "Moment(3)", s.Moment(3), big.NewRat(21, 4))
+	checkEqual(t, "Moment(4)", s.Moment(4), big.NewRat(89, 2))
+}
+
+func TestAddCopies(t *testing.T) {
+	var s summary.Stats
+	s.TrackHigherMoments()
+	v := big.NewRat(3, 1)
+	s.Add(v)
+	v.SetInt64(100)
+	checkEqual(t, "Min", s.Min(), big.NewRat(3, 1))
+	checkEqual(t, "Max", s.Max(), big.NewRat(3, 1))
+}
+
+func TestHigherMoments(t *testing.T) {
+	// The 3rd and 4th moments are reported only if they are tracked, and by
+	// a merge only if both inputs track them.
+	var low, high summary.Stats
+	high.TrackHigherMoments()
+	for _, v := range rats(2, 4, 4, 4, 5, 5, 7, 9) {
+		low.Add(v)
+		high.Add(v)
+	}
+	checkEqual(t, "Moment(2)", low.Moment(2), big.NewRat(4, 1))
+	checkEqual(t, "Moment(3)", low.Moment(3), nil)
+	checkEqual(t, "Moment(4)", low.Moment(4), nil)
+	checkEqual(t, "Var", low.Var(), high.Var())
+
+	high.Merge(&low)
+	checkEqual(t, "Merged Moment(3)", high.Moment(3), nil)
+	checkEqual(t, "Merged Var", high.Var(), big.NewRat(64, 15))
+}
+
+func TestMerge(t *testing.T) {
+	vs := []*big.Rat{
+		big.NewRat(3, 2), big.NewRat(-7, 1), big.NewRat(22, 7), big.NewRat(0, 1),
+		big.NewRat(100, 3), big.NewRat(5, 1), big.NewRat(-1, 9), big.NewRat(12, 1),
+	}
+	var want summary.Stats
+	want.TrackHigherMoments()
+	for _, v := range vs {
+		want.Add(v)
+	}
+
+	// Merging every split of the input should match adding sequentially.
+	for i := range len(vs) + 1 {
+		var a, b summary.Stats
+		a.TrackHigherMoments()
+		b.TrackHigherMoments()
+		for _, v := range vs[:i] {
+			a.Add(v)
+		}
+		for _, v := range vs[i:] {
+			b.Add(v)
+		}
+		a.Merge(&b)
+		checkStats(t, &a, &want)
+	}
+
+	// Merging into an empty value should copy, and leave the input unchanged.
+	var empty summary.Stats
+	empty.TrackHigherMoments()
+	empty.Merge(&want)
+	checkStats(t, &empty, &want)
+	empty.Add(big.NewRat(1000, 1))
+	checkEqual(t, "Original Max", want.Max(), big.NewRat(100, 3))
+}
+
+func TestWeighted(t *testing.T) {
+	// Integer weights are equivalent to repeated values, except for the
+	// variance, which is the estimate for reliability weights.
+	vs := rats(2, 4, 5, 7, 9)
+	ws := rats(1, 3, 2, 1, 1)
+	var s, rep summary.Stats
+	s.TrackHigherMoments()
+	rep.TrackHigherMoments()
+	for i, v := range vs {
+		s.AddWeighted(v, ws[i])
+		for range ws[i].Num().Int64() {
+			rep.Add(v)
+		}
+	}
+	s.AddWeighted(big.NewRat(1000, 1), new(big.Rat)) // ignored
+
+	if s.Count() != 5 {
+		t.Errorf("Count: got %d, want 5", s.Count())
+	}
+	checkEqual(t, "Weight", s.Weight(), big.NewRat(8, 1))
+	checkEqual(t, "EffectiveCount", s.EffectiveCount(), big.NewRat(64, 16))
+	checkEqual(t, "Sum", s.Sum(), rep.Sum())
+	checkEqual(t, "Min", s.Min(), rep.Min())
+	checkEqual(t, "Max", s.Max(), rep.Max())
+	checkEqual(t, "Mean", s.Mean(), rep.Mean())
+	for k := 2; k <= 4; k++ {
+		checkEqual(t, fmt.Sprintf("Moment(%d)", k), s.Moment(k), rep.Moment(k))
+	}
+	// M₂ = 32, W = 8, Σw² = 16, so Var = 32/(8 - 16/8).
+	checkEqual(t, "Var", s.Var(), big.NewRat(32, 6))
+
+	// Merging weighted values matches adding them sequentially.
+	for i := range len(vs) + 1 {
+		var a, b summary.Stats
+		a.TrackHigherMoments()
+		b.TrackHigherMoments()
+		for j, v := range vs {
+			if j < i {
+				a.AddWeighted(v, ws[j])
+			} else {
+				b.AddWeighted(v, ws[j])
+			}
+		}
+		a.Merge(&b)
+		checkStats(t, &a, &s)
+		checkEqual(t, "Merged weight", a.Weight(), s.Weight())
+	}
+
+	// Unit weights are the same as unweighted values.
+	var u summary.Stats
+	u.TrackHigherMoments()
+	for _, v := range vs {
+		u.AddWeighted(v, big.NewRat(1, 1))
+	}
+	var plain summary.Stats
+	plain.TrackHigherMoments()
+	for _, v := range vs {
+		plain.Add(v)
+	}
+	checkStats(t, &u, &plain)
+
+	// A single weighted value has no variance.
+	var one summary.Stats
+	one.TrackHigherMoments()
+	one.AddWeighted(big.NewRat(3, 1), big.NewRat(5, 2))
+	checkEqual(t, "Single Var", one.Var(), nil)
+	checkEqual(t, "Single Mean", one.Mean(), big.NewRat(3, 1))
+}
+
+func TestEncoding(t *testing.T) {
+	var empty, s, low summary.Stats
+	empty.TrackHigherMoments()
+	s.TrackHigherMoments()
+	for _, v := range []int64{3, -1, 4, 1, 5} {
+		s.AddWeighted(big.NewRat(v, 3), big.NewRat(v*v, 1))
+		low.AddWeighted(big.NewRat(v, 3), big.NewRat(v*v, 1))
+	}
+	for _, in := range []*summary.Stats{&empty, &s, &low} {
+		data, err := in.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		var out summary.Stats
+		out.TrackHigherMoments()
+		if err := out.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary(%q): %v", data, err)
+		}
+		if got, _ := out.MarshalBinary(); string(got) != string(data) {
+			t.Errorf("Round trip: got %q, want %q", got, data)
+		}
+		if out.Count() != in.Count() || !sameRat(out.Min(), in.Min()) || !sameRat(out.Var(), in.Var()) ||
+			!sameRat(out.Moment(4), in.Moment(4)) {
+			t.Errorf("Decoded %q: got n=%d min=%v var=%v", data, out.Count(), out.Min(), out.Var())
+		}
+	}
+
+	var f summary.Float
+	for _, bad := range []string{
+		"", "stats0 1", "float1 1 2 3",
+		"stats1 -1 0 0 0 - - 0 0 - -", // negative count
+		"stats1 1 2 2 0 - - 0 0 2 2",  // a value with no weight
+		"stats1 1 2 2 0 - - 1 1 - -",  // a value with no extrema
+	} {
+		if err := s.UnmarshalBinary([]byte(bad)); err == nil {
+			t.Errorf("UnmarshalBinary(%q): got nil, want error", bad)
+		}
+		if err := f.UnmarshalBinary([]byte(bad)); err == nil {
+			t.Errorf("Float.UnmarshalBinary(%q): got nil, want error", bad)
+		}
+	}
+	for _, bad := range []string{
+		"float1 -1 0 0 0 0 0 0 0 0 0 0", // negative count
+		"float1 1 2 0 2 0 0 0 2 2 0 0",  // a value with no weight
+		"float1 1 2 0 2 0 0 0 2 2 NaN 1",
+	} {
+		if err := f.UnmarshalBinary([]byte(bad)); err == nil {
+			t.Errorf("Float.UnmarshalBinary(%q): got nil, want error", bad)
+		}
+	}
+}
+
+func sameRat(a, b *big.Rat) bool {
+	return a == nil && b == nil || a != nil && b != nil && a.Cmp(b) == 0
+}
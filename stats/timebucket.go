@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A timeBucketer assigns records to fixed-width time buckets by the value of
+// a timestamp field. Each bucket is labelled by its start time in UTC, in
+// RFC 3339 format with a fixed number of fractional digits, so that labels
+// sort in time order.
+type timeBucketer struct {
+	field  column
+	layout string        // a time layout, or "" for Unix time
+	scale  time.Duration // for Unix time, the unit of the timestamp
+	width  time.Duration
+	format string // layout of bucket labels
+}
+
+// timeLayouts are the names accepted for standard time layouts.
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// unixLayouts are the names accepted for Unix timestamps, and their units.
+var unixLayouts = map[string]time.Duration{
+	"unix":   time.Second,
+	"unixms": time.Millisecond,
+	"unixus": time.Microsecond,
+	"unixns": time.Nanosecond,
+}
+
+// maxFillBuckets is the maximum number of buckets Fill will add.
+const maxFillBuckets = 1 << 20
+
+// newTimeBucketer returns a bucketer for the timestamps in field, which are
+// parsed according to layout, into buckets of the given width. The layout is
+// the name of a standard layout (e.g., "RFC3339"), the name of a Unix time
+// unit (e.g., "unixms"), or a Go time layout string.
+func newTimeBucketer(field column, layout string, width time.Duration) (*timeBucketer, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("bucket width must be positive")
+	}
+	b := &timeBucketer{field: field, width: width, format: "2006-01-02T15:04:05"}
+	if scale, ok := unixLayouts[layout]; ok {
+		b.scale = scale
+	} else if std, ok := timeLayouts[layout]; ok {
+		b.layout = std
+	} else if layout == "" {
+		return nil, fmt.Errorf("empty time layout")
+	} else {
+		b.layout = layout
+	}
+	switch {
+	case width%time.Second == 0:
+	case width%time.Millisecond == 0:
+		b.format += ".000"
+	case width%time.Microsecond == 0:
+		b.format += ".000000"
+	default:
+		b.format += ".000000000"
+	}
+	b.format += "Z07:00"
+	return b, nil
+}
+
+// Key returns the label of the bucket containing the timestamp s.
+func (b *timeBucketer) Key(s string) (string, error) {
+	t, err := b.parse(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Truncate(b.width).Format(b.format), nil
+}
+
+func (b *timeBucketer) parse(s string) (time.Time, error) {
+	if b.layout != "" {
+		return time.Parse(b.layout, s)
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > math.MaxInt64/int64(b.scale) || n < math.MinInt64/int64(b.scale) {
+			return time.Time{}, fmt.Errorf("timestamp %q out of range", s)
+		}
+		return time.Unix(0, n*int64(b.scale)), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	ns := f * float64(b.scale)
+	if math.IsNaN(ns) || ns >= math.MaxInt64 || ns < math.MinInt64 {
+		return time.Time{}, fmt.Errorf("timestamp %q out of range", s)
+	}
+	return time.Unix(0, int64(ns)), nil
+}
+
+// Fill adds an empty group to gs for each bucket between the first and last
+// buckets of gs that has no values, so that the report has a row for every
+// bucket. The groups of gs must be keyed by bucket label.
+func (b *timeBucketer) Fill(gs *groupSet) error {
+	var lo, hi time.Time
+	for _, grp := range gs.groups {
+		t, err := time.Parse(time.RFC3339, grp.key[0])
+		if err != nil {
+			return fmt.Errorf("invalid bucket label %q", grp.key[0])
+		}
+		if lo.IsZero() || t.Before(lo) {
+			lo = t
+		}
+		if hi.IsZero() || t.After(hi) {
+			hi = t
+		}
+	}
+	if n := hi.Sub(lo) / b.width; n >= maxFillBuckets {
+		return fmt.Errorf("too many time buckets (%d) between %s and %s",
+			n+1, lo.Format(b.format), hi.Format(b.format))
+	}
+	for t := lo; len(gs.groups) != 0 && !t.After(hi); t = t.Add(b.width) {
+		gs.Add([]string{t.Format(b.format)}, nil) // no effect if the group exists
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTimeBucketKey(t *testing.T) {
+	tests := []struct {
+		layout string
+		width  time.Duration
+		input  string
+		want   string
+	}{
+		{"RFC3339", time.Minute, "2026-10-17T10:00:59Z", "2026-10-17T10:00:00Z"},
+		{"RFC3339", time.Minute, "2026-10-17T10:00:59-07:00", "2026-10-17T17:00:00Z"},
+		{"RFC3339", time.Hour, "2026-10-17T10:59:59.999Z", "2026-10-17T10:00:00Z"},
+		{"DateTime", 24 * time.Hour, "2026-10-17 23:59:59", "2026-10-17T00:00:00Z"},
+		{"2006/01/02 15:04", 15 * time.Minute, "2026/10/17 10:44", "2026-10-17T10:30:00Z"},
+		{"unix", time.Minute, "1700000000", "2023-11-14T22:13:00Z"},
+		{"unix", 100 * time.Millisecond, "1700000000.25", "2023-11-14T22:13:20.200Z"},
+		{"unixms", time.Second, " 1700000000999 ", "2023-11-14T22:13:20Z"},
+		{"unixus", time.Microsecond, "1700000000000001", "2023-11-14T22:13:20.000001Z"},
+		{"unixns", 1, "1700000000000000001", "2023-11-14T22:13:20.000000001Z"},
+	}
+	for _, tc := range tests {
+		b, err := newTimeBucketer(column{index: 1}, tc.layout, tc.width)
+		if err != nil {
+			t.Fatalf("newTimeBucketer(%q, %v): %v", tc.layout, tc.width, err)
+		}
+		got, err := b.Key(tc.input)
+		if err != nil {
+			t.Errorf("Key(%q) [%s]: unexpected error: %v", tc.input, tc.layout, err)
+		} else if got != tc.want {
+			t.Errorf("Key(%q) [%s]: got %q, want %q", tc.input, tc.layout, got, tc.want)
+		}
+	}
+
+	b, err := newTimeBucketer(column{index: 1}, "unixms", time.Minute)
+	if err != nil {
+		t.Fatalf("newTimeBucketer: %v", err)
+	}
+	for _, bad := range []string{"", "soon", "1e30", "NaN"} {
+		if got, err := b.Key(bad); err == nil {
+			t.Errorf("Key(%q): got %q, want error", bad, got)
+		}
+	}
+	if _, err := newTimeBucketer(column{index: 1}, "unix", 0); err == nil {
+		t.Error("newTimeBucketer with zero width: got nil error, want error")
+	}
+}
+
+func TestTimeBucketFill(t *testing.T) {
+	b, err := newTimeBucketer(column{index: 1}, "RFC3339", time.Minute)
+	if err != nil {
+		t.Fatalf("newTimeBucketer: %v", err)
+	}
+	gs := newGroupSet(1, collectOptions{})
+	for _, ts := range []string{"10:03:30", "10:00:10", "10:03:00", "10:01:59"} {
+		key, err := b.Key("2026-10-17T" + ts + "Z")
+		if err != nil {
+			t.Fatalf("Key(%q): %v", ts, err)
+		}
+		gs.Add([]string{key}, []value{floatValue(1)})
+	}
+	if err := b.Fill(gs); err != nil {
+		t.Fatalf("Fill: unexpected error: %v", err)
+	}
+
+	rs, err := gs.Report(nil, []unitKind{noUnit}, "key", 0)
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	var got []string
+	for _, r := range rs {
+		got = append(got, r.key[0][11:16]+"="+r.results[0][0].value)
+	}
+	if want := []string{"10:00=1", "10:01=1", "10:02=0", "10:03=2"}; !slices.Equal(got, want) {
+		t.Errorf("Buckets: got %q, want %q", got, want)
+	}
+
+	// Fill refuses to add an unreasonable number of buckets.
+	gs.Add([]string{"1970-01-01T00:00:00Z"}, nil)
+	if err := b.Fill(gs); err == nil {
+		t.Error("Fill: got nil error, want error")
+	}
+}
+
+func TestTimeBucketEmptyRow(t *testing.T) {
+	setFlags(t, "max", "true", "mean", "true", "median", "true", "stdev", "true")
+	b, err := newTimeBucketer(column{index: 1}, "RFC3339", time.Minute)
+	if err != nil {
+		t.Fatalf("newTimeBucketer: %v", err)
+	}
+	gs := newGroupSet(1, collectOptions{quantiles: true})
+	for _, in := range []struct {
+		ts string
+		v  float64
+	}{{"10:00:01", 5}, {"10:00:30", 6}, {"10:02:01", 7}} {
+		key, err := b.Key("2026-10-17T" + in.ts + "Z")
+		if err != nil {
+			t.Fatalf("Key(%q): %v", in.ts, err)
+		}
+		gs.Add([]string{key}, []value{floatValue(in.v)})
+	}
+	fields := []column{{index: 2}}
+	rep := &reporter{pick: newPicker(fields, nil, noUnit, false), fields: fields, keys: []column{{name: "time"}}}
+	rep.pick.time = b
+
+	// The statistics of an empty bucket are undefined, not zero.
+	var buf bytes.Buffer
+	if err := rep.write(&buf, gs); err != nil {
+		t.Fatalf("Write report: %v", err)
+	}
+	const want = `                  time  n  max  avg  sdv  med
+  2026-10-17T10:00:00Z  2    6  5.5  0.7  5.5
+  2026-10-17T10:01:00Z  0    -    -    -    -
+  2026-10-17T10:02:00Z  1    7    7    -    7
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Report (-want, +got):\n%s", diff)
+	}
+}
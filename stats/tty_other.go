@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+// ttyWidth reports the width of the terminal, which is not known on this
+// platform.
+func ttyWidth() int { return 0 }
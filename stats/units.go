@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// A unitKind identifies the kind of units in which values are measured.
+type unitKind int32
+
+const (
+	noUnit       unitKind = iota // plain numbers
+	durationUnit                 // time durations, in seconds
+	bytesUnit                    // data sizes, in bytes
+	percentUnit                  // percentages, in percent
+
+	autoUnit unitKind = -1 // detect units from the input
+)
+
+// parseUnitKind parses the name of a -units mode.
+func parseUnitKind(s string) (unitKind, error) {
+	switch s {
+	case "", "none":
+		return noUnit, nil
+	case "duration":
+		return durationUnit, nil
+	case "bytes":
+		return bytesUnit, nil
+	case "percent":
+		return percentUnit, nil
+	case "auto":
+		return autoUnit, nil
+	default:
+		return 0, fmt.Errorf("unknown unit %q", s)
+	}
+}
+
+func (k unitKind) String() string {
+	switch k {
+	case durationUnit:
+		return "duration"
+	case bytesUnit:
+		return "bytes"
+	case percentUnit:
+		return "percent"
+	case autoUnit:
+		return "auto"
+	default:
+		return "none"
+	}
+}
+
+// A unitScale is a unit suffix and its size in base units.
+type unitScale struct {
+	suffix string
+	scale  *big.Rat
+}
+
+func pow(base, exp int64) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(base), big.NewInt(exp), nil))
+}
+
+var (
+	// Duration units, in seconds.
+	durationScales = map[string]*big.Rat{
+		"ns": big.NewRat(1, 1e9),
+		"us": big.NewRat(1, 1e6), "µs": big.NewRat(1, 1e6), "μs": big.NewRat(1, 1e6),
+		"ms": big.NewRat(1, 1e3),
+		"s":  big.NewRat(1, 1),
+		"m":  big.NewRat(60, 1),
+		"h":  big.NewRat(3600, 1),
+	}
+
+	// Data size units, in bytes. Following the convention of tools like du and
+	// ls, a bare prefix letter (e.g., "K") denotes a power of 1024.
+	byteScales = map[string]*big.Rat{
+		"B": big.NewRat(1, 1),
+		"K": pow(1024, 1), "KiB": pow(1024, 1), "KB": pow(1000, 1), "kB": pow(1000, 1),
+		"M": pow(1024, 2), "MiB": pow(1024, 2), "MB": pow(1000, 2),
+		"G": pow(1024, 3), "GiB": pow(1024, 3), "GB": pow(1000, 3),
+		"T": pow(1024, 4), "TiB": pow(1024, 4), "TB": pow(1000, 4),
+		"P": pow(1024, 5), "PiB": pow(1024, 5), "PB": pow(1000, 5),
+		"E": pow(1024, 6), "EiB": pow(1024, 6), "EB": pow(1000, 6),
+	}
+
+	// Units used for formatting, in decreasing order of size.
+	durationFormat = []unitScale{
+		{"h", durationScales["h"]}, {"m", durationScales["m"]}, {"s", durationScales["s"]},
+		{"ms", durationScales["ms"]}, {"µs", durationScales["µs"]}, {"ns", durationScales["ns"]},
+	}
+	bytesFormat = []unitScale{
+		{"EiB", pow(1024, 6)}, {"PiB", pow(1024, 5)}, {"TiB", pow(1024, 4)},
+		{"GiB", pow(1024, 3)}, {"MiB", pow(1024, 2)}, {"KiB", pow(1024, 1)}, {"B", big.NewRat(1, 1)},
+	}
+)
+
+// numberPrefix matches a decimal number, possibly with comma-separated groups
+// of thousands, at the beginning of a string.
+var numberPrefix = regexp.MustCompile(`^[-+]?(?:\d{1,3}(?:,\d{3})+|\d*)(?:\.\d*)?(?:[eE][-+]?\d+)?`)
+
+// splitNumber splits s into a leading number, with any grouping commas
+// removed, and the remainder.
+func splitNumber(s string) (*big.Rat, string, error) {
+	m := numberPrefix.FindString(s)
+	v, ok := new(big.Rat).SetString(strings.ReplaceAll(m, ",", ""))
+	if !ok {
+		return nil, "", fmt.Errorf("invalid number format for %q", s)
+	}
+	return v, strings.TrimSpace(s[len(m):]), nil
+}
+
+// parseQuantity parses s as a number followed by an optional unit of the
+// given kind. A number without a unit is taken to be in base units. If kind
+// is autoUnit, any recognized unit is accepted. It returns the value in base
+// units and the kind of unit found, or noUnit if there was none.
+func parseQuantity(s string, kind unitKind) (*big.Rat, unitKind, error) {
+	v, rest, err := splitNumber(s)
+	if err != nil {
+		return nil, 0, err
+	}
+	var found unitKind
+	switch {
+	case rest == "":
+		return v, noUnit, nil
+	case rest == "%":
+		found = percentUnit
+	case byteScales[rest] != nil:
+		v.Mul(v, byteScales[rest])
+		found = bytesUnit
+	default:
+		v, err = parseDuration(v, rest)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid quantity %q: %w", s, err)
+		}
+		found = durationUnit
+	}
+	if kind != autoUnit && found != kind {
+		return nil, 0, fmt.Errorf("invalid %s %q", kind, s)
+	}
+	return v, found, nil
+}
+
+// parseDuration parses a duration given its leading number v and the rest of
+// the string, which begins with a unit. The rest may contain further pairs of
+// numbers and units, as in "1h30m" or "2m3.5s".
+func parseDuration(v *big.Rat, rest string) (*big.Rat, error) {
+	sum := new(big.Rat)
+	for {
+		i := strings.IndexAny(rest, "0123456789.")
+		if i < 0 {
+			i = len(rest)
+		}
+		scale, ok := durationScales[rest[:i]]
+		if !ok {
+			return nil, fmt.Errorf("unknown unit %q", rest[:i])
+		}
+		sum.Add(sum, v.Mul(v, scale))
+		if rest = rest[i:]; rest == "" {
+			return sum, nil
+		}
+		m := numberPrefix.FindString(rest)
+		if m == "" {
+			return nil, fmt.Errorf("missing number before %q", rest)
+		}
+		v, ok = new(big.Rat).SetString(m)
+		if !ok {
+			return nil, fmt.Errorf("invalid number %q", m)
+		}
+		rest = rest[len(m):]
+	}
+}
+
+// Format formats v, given in base units of kind k, using the largest unit in
+// which its magnitude is at least 1.
+func (k unitKind) Format(v *big.Rat) string {
+	if v == nil {
+		return ratString(v)
+	}
+	var scales []unitScale
+	var base string
+	switch k {
+	case durationUnit:
+		scales, base = durationFormat, "s"
+	case bytesUnit:
+		scales, base = bytesFormat, "B"
+	case percentUnit:
+		return ratString(v) + "%"
+	default:
+		return ratString(v)
+	}
+	if v.Sign() == 0 {
+		return "0" + base
+	}
+	u := scales[len(scales)-1]
+	abs := new(big.Rat).Abs(v)
+	for _, s := range scales {
+		if abs.Cmp(s.scale) >= 0 {
+			u = s
+			break
+		}
+	}
+	return ratString(new(big.Rat).Quo(v, u.scale)) + u.suffix
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		input string
+		kind  unitKind
+		want  *big.Rat
+		found unitKind
+	}{
+		{"1,234,567", noUnit, big.NewRat(1234567, 1), noUnit},
+		{"25", durationUnit, big.NewRat(25, 1), noUnit},
+		{"1.5s", durationUnit, big.NewRat(3, 2), durationUnit},
+		{"320ms", durationUnit, big.NewRat(8, 25), durationUnit},
+		{"1h2m3.5s", durationUnit, big.NewRat(7447, 2), durationUnit},
+		{"-4µs", durationUnit, big.NewRat(-4, 1e6), durationUnit},
+		{"4.2KiB", bytesUnit, big.NewRat(21504, 5), bytesUnit},
+		{"3 MB", bytesUnit, big.NewRat(3e6, 1), bytesUnit},
+		{"2G", bytesUnit, big.NewRat(1<<31, 1), bytesUnit},
+		{"12%", percentUnit, big.NewRat(12, 1), percentUnit},
+		{"12.5%", autoUnit, big.NewRat(25, 2), percentUnit},
+		{"100ns", autoUnit, big.NewRat(1, 1e7), durationUnit},
+		{"1,024B", autoUnit, big.NewRat(1024, 1), bytesUnit},
+	}
+	for _, tc := range tests {
+		got, found, err := parseQuantity(tc.input, tc.kind)
+		if err != nil {
+			t.Errorf("parseQuantity(%q, %v): unexpected error: %v", tc.input, tc.kind, err)
+			continue
+		}
+		if got.Cmp(tc.want) != 0 || found != tc.found {
+			t.Errorf("parseQuantity(%q, %v): got %v, %v; want %v, %v",
+				tc.input, tc.kind, got, found, tc.want, tc.found)
+		}
+	}
+
+	for _, bad := range []struct {
+		input string
+		kind  unitKind
+	}{
+		{"1.5s", bytesUnit},
+		{"4KiB", durationUnit},
+		{"12%", durationUnit},
+		{"3 parsecs", autoUnit},
+		{"1,23", autoUnit},
+		{"s", durationUnit},
+	} {
+		if got, _, err := parseQuantity(bad.input, bad.kind); err == nil {
+			t.Errorf("parseQuantity(%q, %v): got %v, want error", bad.input, bad.kind, got)
+		}
+	}
+}
+
+func TestUnitFormat(t *testing.T) {
+	defer func(old int) { *precision = old }(*precision)
+	*precision = 1
+
+	tests := []struct {
+		kind unitKind
+		v    *big.Rat
+		want string
+	}{
+		{noUnit, big.NewRat(5, 2), "2.5"},
+		{durationUnit, big.NewRat(212, 1000), "212ms"},
+		{durationUnit, big.NewRat(90, 1), "1.5m"},
+		{durationUnit, big.NewRat(0, 1), "0s"},
+		{durationUnit, big.NewRat(-3, 1e9), "-3ns"},
+		{bytesUnit, big.NewRat(3328599654, 1), "3.1GiB"},
+		{bytesUnit, big.NewRat(512, 1), "512B"},
+		{percentUnit, big.NewRat(12, 1), "12%"},
+	}
+	for _, tc := range tests {
+		if got := tc.kind.Format(tc.v); got != tc.want {
+			t.Errorf("%v.Format(%v): got %q, want %q", tc.kind, tc.v, got, tc.want)
+		}
+	}
+}
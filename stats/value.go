@@ -0,0 +1,71 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"math/big"
+)
+
+// A value is a single input value. With -exact, values are exact rationals;
+// otherwise they are float64, which is much faster to parse and accumulate,
+// except for integers that fit in an int64 but not exactly in a float64,
+// which are kept as rationals.
+type value struct {
+	r *big.Rat // the exact value, or nil for a float64 value
+	f float64  // the value, if r == nil
+}
+
+func ratValue(r *big.Rat) value  { return value{r: r} }
+func floatValue(f float64) value { return value{f: f} }
+
+// Rat returns v as a rational.
+func (v value) Rat() *big.Rat {
+	if v.r != nil {
+		return v.r
+	}
+	return new(big.Rat).SetFloat64(v.f)
+}
+
+// Float returns v as a float64, rounded if necessary.
+func (v value) Float() float64 {
+	if v.r != nil {
+		f, _ := v.r.Float64()
+		return f
+	}
+	return v.f
+}
+
+// maxExactInt is the largest magnitude below which every integer can be
+// represented exactly as a float64.
+const maxExactInt = 1 << 53
+
+// Int64 returns v as an int64, and reports whether v is an integer in the
+// range of int64.
+func (v value) Int64() (int64, bool) {
+	if v.r != nil {
+		if v.r.IsInt() && v.r.Num().IsInt64() {
+			return v.r.Num().Int64(), true
+		}
+		return 0, false
+	} else if v.f == math.Trunc(v.f) && math.Abs(v.f) <= maxExactInt {
+		return int64(v.f), true
+	}
+	return 0, false
+}
+
+// Cmp compares v and w, returning -1, 0, or +1. If either is a float64, the
+// comparison is done in float64.
+func (v value) Cmp(w value) int {
+	if v.r != nil && w.r != nil {
+		return v.r.Cmp(w.r)
+	}
+	return cmp.Compare(v.Float(), w.Float())
+}
+
+// Sign returns -1, 0, or +1 according to the sign of v.
+func (v value) Sign() int {
+	if v.r != nil {
+		return v.r.Sign()
+	}
+	return cmp.Compare(v.f, 0)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// A pairCollector accumulates statistics on the relationship between two
+// selected fields, X and Y. The means and co-moments are updated in float64
+// with Welford's method, and the values are retained for rank correlation.
+type pairCollector struct {
+	n             int64
+	mx, my        float64 // running means of X and Y
+	sxx, syy, sxy float64 // sums of squared differences and co-moment
+	xs, ys        []float64
+}
+
+// Add adds the pair (x, y) to p.
+func (p *pairCollector) Add(x, y float64) {
+	p.n++
+	n := float64(p.n)
+	dx, dy := x-p.mx, y-p.my
+	p.mx += dx / n
+	p.my += dy / n
+	p.sxx += dx * (x - p.mx)
+	p.syy += dy * (y - p.my)
+	p.sxy += dx * (y - p.my)
+	p.xs = append(p.xs, x)
+	p.ys = append(p.ys, y)
+}
+
+// Merge adds the pairs collected by o to p.
+func (p *pairCollector) Merge(o *pairCollector) {
+	if o.n == 0 {
+		return
+	} else if p.n == 0 {
+		*p = *o
+		p.xs, p.ys = slices.Clone(o.xs), slices.Clone(o.ys)
+		return
+	}
+	// See summary.Stats.Merge; the co-moment combines in the same way.
+	n1, n2 := float64(p.n), float64(o.n)
+	n := n1 + n2
+	dx, dy := o.mx-p.mx, o.my-p.my
+	p.sxx += o.sxx + dx*dx*n1*n2/n
+	p.syy += o.syy + dy*dy*n1*n2/n
+	p.sxy += o.sxy + dx*dy*n1*n2/n
+	p.mx += dx * n2 / n
+	p.my += dy * n2 / n
+	p.n += o.n
+	p.xs = append(p.xs, o.xs...)
+	p.ys = append(p.ys, o.ys...)
+}
+
+// Report returns the correlation and regression statistics for p. The
+// covariance is the sample covariance unless -pop is set. The regression is
+// the least-squares fit of Y on X.
+func (p *pairCollector) Report() []result {
+	cov, pearson, slope, icept := math.NaN(), math.NaN(), math.NaN(), math.NaN()
+	n := float64(p.n)
+	if *doPop && p.n > 0 {
+		cov = p.sxy / n
+	} else if p.n > 1 {
+		cov = p.sxy / (n - 1)
+	}
+	if p.sxx > 0 {
+		slope = p.sxy / p.sxx
+		icept = p.my - slope*p.mx
+		if p.syy > 0 {
+			pearson = p.sxy / math.Sqrt(p.sxx*p.syy)
+		}
+	}
+	out := []result{{key: "n", value: strconv.FormatInt(p.n, 10), num: ratFloat(n)}}
+	add := func(key string, f float64) {
+		v := ratFloat(f)
+		out = append(out, result{key: key, value: ratString(v), num: v, approx: true})
+	}
+	add("cov", cov)
+	add("pearson", pearson)
+	add("spearman", spearman(p.xs, p.ys))
+	add("slope", slope)
+	add("intercept", icept)
+	add("r2", pearson*pearson)
+	return out
+}
+
+// spearman returns Spearman's rank correlation coefficient for the pairs
+// (xs[i], ys[i]), or NaN if it is not defined.
+func spearman(xs, ys []float64) float64 {
+	var q pairCollector
+	rx, ry := ranks(xs), ranks(ys)
+	for i := range rx {
+		q.Add(rx[i], ry[i])
+	}
+	if q.sxx == 0 || q.syy == 0 {
+		return math.NaN()
+	}
+	return q.sxy / math.Sqrt(q.sxx*q.syy)
+}
+
+// ranks returns the 1-based ranks of vs in increasing order, with tied
+// values assigned the average of their ranks.
+func ranks(vs []float64) []float64 {
+	idx := make([]int, len(vs))
+	for i := range idx {
+		idx[i] = i
+	}
+	slices.SortFunc(idx, func(a, b int) int { return cmp.Compare(vs[a], vs[b]) })
+	out := make([]float64, len(vs))
+	for i := 0; i < len(idx); {
+		j := i + 1
+		for j < len(idx) && vs[idx[j]] == vs[idx[i]] {
+			j++
+		}
+		for _, k := range idx[i:j] {
+			out[k] = float64(i+j+1) / 2
+		}
+		i = j
+	}
+	return out
+}
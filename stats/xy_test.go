@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestPairCollector(t *testing.T) {
+	xs := []float64{1, 2, 3, 4, 5}
+	ys := []float64{2, 4, 5, 4, 5}
+	want := map[string]float64{
+		"n": 5, "cov": 1.5, "pearson": 0.774597, "spearman": 0.737865,
+		"slope": 0.6, "intercept": 2.2, "r2": 0.6,
+	}
+	check := func(label string, p *pairCollector) {
+		t.Helper()
+		for _, r := range p.Report() {
+			w, ok := want[r.key]
+			if !ok {
+				t.Errorf("%s: unexpected statistic %q", label, r.key)
+				continue
+			}
+			if r.num == nil {
+				t.Errorf("%s: %s: got nil, want %v", label, r.key, w)
+			} else if g, _ := r.num.Float64(); math.Abs(g-w) > 1e-6 {
+				t.Errorf("%s: %s: got %v, want %v", label, r.key, r.value, w)
+			}
+		}
+	}
+
+	var p pairCollector
+	for i := range xs {
+		p.Add(xs[i], ys[i])
+	}
+	check("Sequential", &p)
+
+	// Merging any split of the input should give the same result.
+	for i := range len(xs) + 1 {
+		var a, b pairCollector
+		for j := range xs {
+			if j < i {
+				a.Add(xs[j], ys[j])
+			} else {
+				b.Add(xs[j], ys[j])
+			}
+		}
+		a.Merge(&b)
+		check("Merged", &a)
+	}
+}
+
+func TestRanks(t *testing.T) {
+	got := ranks([]float64{10, 30, 20, 30, 5})
+	if want := []float64{2, 4.5, 3, 4.5, 1}; !slices.Equal(got, want) {
+		t.Errorf("ranks: got %v, want %v", got, want)
+	}
+}
+
+func TestPairUndefined(t *testing.T) {
+	// Statistics that are not defined for the input print as "-", not "0".
+	tests := []struct {
+		name   string
+		xs, ys []float64
+		want   string
+	}{
+		{"ConstantX", []float64{3, 3, 3}, []float64{1, 2, 4},
+			"n=3, cov=0, pearson=-, spearman=-, slope=-, intercept=-, r2=-"},
+		{"ConstantY", []float64{1, 2, 4}, []float64{3, 3, 3},
+			"n=3, cov=0, pearson=-, spearman=-, slope=0, intercept=3, r2=-"},
+		{"Single", []float64{1}, []float64{2},
+			"n=1, cov=-, pearson=-, spearman=-, slope=-, intercept=-, r2=-"},
+	}
+	for _, tc := range tests {
+		var p pairCollector
+		for i := range tc.xs {
+			p.Add(tc.xs[i], tc.ys[i])
+		}
+		if got := formatResults(p.Report()); got != tc.want {
+			t.Errorf("%s:\ngot:  %s\nwant: %s", tc.name, got, tc.want)
+		}
+	}
+}